@@ -3,13 +3,14 @@ package agent
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/y7ut/logagent/conf"
 	"github.com/y7ut/logagent/etcd"
 )
 
@@ -18,14 +19,25 @@ var (
 	CloseChan = make(chan Collector)
 )
 
+const (
+	// 退出时等待发送协程写完剩余批次的最长时间
+	senderExitTimeout = 10 * time.Second
+	// 退出时关闭每个收集器之后等待的时间
+	collectorExitWait = 500 * time.Millisecond
+	// 默认每隔多久记录一次检查点
+	defaultCheckpointInterval = 5 * time.Second
+)
+
 type App struct {
 	runtimePath string
 	Agents      map[string]*LogAgent
 	mu          sync.Mutex
+	senderDone  chan struct{} // 发送协程把剩余的批次写完后关闭
+	checkpoints *checkpointStore
 }
 
-func NewApp(runtimePath string) *App {
-	return &App{runtimePath: runtimePath, Agents: make(map[string]*LogAgent)}
+func NewApp(runtimePath string, checkpoints *checkpointStore) *App {
+	return &App{runtimePath: runtimePath, Agents: make(map[string]*LogAgent), senderDone: make(chan struct{}), checkpoints: checkpoints}
 }
 
 func (app *App) setAgent(path string, agent *LogAgent) {
@@ -49,9 +61,13 @@ func (app *App) getAgent(path string) (*LogAgent, bool) {
 	return result, ok
 }
 
+// allAgent 返回一份拷贝，遍历的时候不会和增删冲突
 func (app *App) allAgent() (Agents map[string]*LogAgent) {
 	app.mu.Lock()
-	Agents = app.Agents
+	Agents = make(map[string]*LogAgent, len(app.Agents))
+	for path, agent := range app.Agents {
+		Agents[path] = agent
+	}
 	app.mu.Unlock()
 	return Agents
 }
@@ -78,12 +94,12 @@ func (app *App) RegisterFirst() (int, error) {
 	for _, collector := range configFromEtcd {
 		_, ok := app.getAgent(collector.Path)
 		if ok {
-			log.Println("already exist:" + collector.Path)
+			slog.Warn("collector already exists", "path", collector.Path)
 			continue
 		}
 		StartChan <- collector
 		count++
-		log.Println("init Add Agent :", collector)
+		slog.Info("add collector", "path", collector.Path, "topic", collector.Topic, "style", collector.Style)
 		time.Sleep(300 * time.Millisecond)
 	}
 
@@ -104,7 +120,7 @@ func (app *App) ListenCollectorStart(ctx context.Context) {
 			currentLogAgent, err := NewAgent(collector)
 
 			if err != nil {
-				log.Println(err)
+				slog.Error("failed to create collector", "path", collector.Path, "err", err)
 				continue
 			}
 			// 激活注册创建的Agent
@@ -113,7 +129,7 @@ func (app *App) ListenCollectorStart(ctx context.Context) {
 			// 启动Agent
 			currentLogAgent.Start(ctx)
 
-			log.Println("watching ", currentLogAgent.Collector.Path)
+			slog.Info("watching", "path", currentLogAgent.Collector.Path)
 		}
 	}
 }
@@ -127,14 +143,15 @@ func (app *App) ListenCollectorClose() {
 		// 很多情况都可以触发这个行为，必须更换日期了，或者退出程序
 		shutdownLogAgent, ok := app.getAgent(collector.Path)
 		if !ok {
-			log.Println("close a unsafe Agent:", collector.Path)
+			slog.Warn("close an unknown collector", "path", collector.Path)
 			continue
 		}
+		// 先移除再停止，等待它退出后启动的同名收集器不会被误删
+		app.deleteAgent(shutdownLogAgent.Collector.Path)
+
 		// 停止Agent
 		shutdownLogAgent.Stop()
-
-		app.deleteAgent(shutdownLogAgent.Collector.Path)
-		log.Println("already close Agent collector for ", shutdownLogAgent.Collector.Path)
+		slog.Info("collector closed", "path", shutdownLogAgent.Collector.Path)
 	}
 }
 
@@ -148,12 +165,32 @@ func (app *App) Run() {
 
 	etcd.Init()
 
+	budget.setLimit(conf.APPConfig.Kafka.MemoryLimit)
+	if conf.APPConfig.Metrics.Address != "" {
+		go serveMetrics(conf.APPConfig.Metrics.Address)
+	}
+
 	// 收集所有消息，每个消息中包含了应该对应Topic的Kafka-Producer
-	go KafkaSender(Ctx)
+	go func() {
+		KafkaSender(Ctx)
+		close(app.senderDone)
+	}()
+
+	// 在收集器之间公平调度
+	go logScheduler.run(Ctx)
 
 	// 监听ETCD中Collector
 	go watchEtcdConfig(Ctx)
 
+	// 定期记录检查点
+	go app.checkpointLoop(Ctx, conf.APPConfig.Runtime.CheckpointInterval)
+
+	// 定期记录心跳，list --all 用来判断节点是否还活着
+	go heartbeatLoop(Ctx)
+
+	// systemd 的看门狗
+	go app.watchdogLoop(Ctx)
+
 	// 代理激活
 	go app.ListenCollectorStart(Ctx)
 
@@ -165,31 +202,97 @@ func (app *App) Run() {
 		fmt.Println(err.Error())
 		return
 	}
-	log.Printf("total start %d logagent\n", count)
+	slog.Info("collectors started", "count", count)
+	notifyReady(count)
 
 	for s := range sign() {
 		switch s {
 		case syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM:
-			log.Println("Safe Exit:", s)
-			app.safeExit()
+			slog.Info("safe exit", "signal", s.String())
+			app.safeExit(cancel)
 			return
 		}
 	}
 
 }
 
-func (app *App) safeExit() {
+// StopTimeout 有 collectors 个收集器时退出最长需要的时间
+func StopTimeout(collectors int) time.Duration {
+	return time.Duration(collectors)*collectorExitWait + senderExitTimeout
+}
+
+func (app *App) safeExit(cancel context.CancelFunc) {
+	notifyStopping()
+
 	AllAgents := app.allAgent()
 	for _, logagent := range AllAgents {
 		//没有保存的删除了
 		CloseChan <- logagent.Collector
-		time.Sleep(500 * time.Millisecond)
+		time.Sleep(collectorExitWait)
+	}
+
+	// 通知发送协程退出，并等待缓冲中的批次写完
+	cancel()
+	select {
+	case <-app.senderDone:
+	case <-time.After(senderExitTimeout):
+		slog.Warn("wait for kafka sender timeout", "timeout", senderExitTimeout)
+	}
+	// 收集器退出时还有没写完的行，发送协程退出后再记录一次写到的位置
+	for _, logagent := range AllAgents {
+		if err := logagent.finalCheckpoint(); err != nil {
+			slog.Warn("failed to checkpoint", "path", logagent.Collector.Path, "err", err)
+		}
+	}
+
+	if err := app.checkpoints.Close(); err != nil {
+		slog.Error("failed to close checkpoint store", "err", err)
 	}
 
 	etcd.CloseEvent()
 	os.Exit(0)
 }
 
+// checkpointLoop 定期记录所有收集器的读取位置并落盘
+func (app *App) checkpointLoop(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultCheckpointInterval
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			for _, logagent := range app.allAgent() {
+				if err := logagent.checkpoint(); err != nil {
+					slog.Warn("failed to checkpoint", "path", logagent.Collector.Path, "err", err)
+				}
+			}
+			if err := app.checkpoints.Flush(); err != nil {
+				slog.Error("failed to flush checkpoint store", "err", err)
+			}
+		}
+	}
+}
+
+// heartbeatLoop 启动时和之后每隔 etcd.HeartbeatInterval 记录一次心跳
+func heartbeatLoop(ctx context.Context) {
+	tick := time.NewTicker(etcd.HeartbeatInterval)
+	defer tick.Stop()
+	for {
+		if err := etcd.Heartbeat(); err != nil {
+			slog.Warn("failed to send heartbeat", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
 func sign() <-chan os.Signal {
 	c := make(chan os.Signal, 2)
 
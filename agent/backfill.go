@@ -0,0 +1,275 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	defaultBackfillRate = 1000
+	// 每读多少行更新一次回填进度
+	backfillCheckpointLines = 1000
+	// 归档已经回填完成的标记
+	backfillDone int64 = -1
+)
+
+var (
+	magicGzip = []byte{0x1F, 0x8B}
+	magicZstd = []byte{0x28, 0xB5, 0x2F, 0xFD}
+)
+
+// backfillHorizonKey 收集器第一次开启回填的时间，只有在这之前就已经轮转出去的归档才需要回填
+// 之后轮转出来的归档，内容已经被 tail 发送过了
+func backfillHorizonKey(path string) string {
+	return path + "#backfill"
+}
+
+// backfillArchiveKey 归档的回填进度，用解压后开头的指纹和长度标识
+// 归档被改名或者压缩后内容不变，不会重复发送
+func backfillArchiveKey(path, archive string) (string, error) {
+	reader, closer, err := openArchive(archive)
+	if err != nil {
+		return "", err
+	}
+	defer closer()
+
+	h := sha256.New()
+	head, err := io.CopyN(h, reader, fingerprintSize)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	rest, err := io.Copy(io.Discard, reader)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s#backfill#%x-%d", path, h.Sum(nil)[:8], head+rest), nil
+}
+
+// legacyArchiveKey 旧版本用 inode 和大小标识归档，升级后继续沿用它记录的进度
+func legacyArchiveKey(path string, info os.FileInfo) string {
+	var ino uint64
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		ino = stat.Ino
+	}
+	return fmt.Sprintf("%s#backfill#%d-%d", path, ino, info.Size())
+}
+
+// backfill 按照时间顺序回填收集器已经轮转出去的历史归档
+func (l *LogAgent) backfill(ctx context.Context, lane chan<- *Log) {
+	horizonKey := backfillHorizonKey(l.Collector.Path)
+	cp, ok := app.checkpoints.Get(horizonKey)
+	horizon := cp.Offset
+	if !ok {
+		horizon = time.Now().Unix()
+		app.checkpoints.Put(Checkpoint{Source: horizonKey, Offset: horizon})
+		if err := app.checkpoints.Flush(); err != nil {
+			slog.Warn("failed to record backfill horizon", "path", l.Collector.Path, "err", err)
+			return
+		}
+	}
+
+	archives := l.archives(time.Unix(horizon, 0))
+	if len(archives) == 0 {
+		return
+	}
+	slog.Info("backfill archives", "path", l.Collector.Path, "archives", len(archives))
+
+	rate := l.Collector.BackfillRate
+	if rate <= 0 {
+		rate = defaultBackfillRate
+	}
+	limiter := newRateLimiter(Collector{RateLines: rate, OverLimit: OverLimitBlock})
+
+	for _, archive := range archives {
+		if !l.backfillArchive(ctx, archive, limiter, lane) {
+			return
+		}
+	}
+	slog.Info("backfill finished", "path", l.Collector.Path)
+}
+
+// archives 找到收集器所有在 horizon 之前轮转出去的归档，按照修改时间从旧到新排列
+func (l *LogAgent) archives(horizon time.Time) []string {
+	patterns := make([]string, 0, 2)
+	switch l.Collector.Style {
+	case "Date":
+		// 其他日期的文件，以及它们的压缩或者轮转文件
+		pattern := strings.NewReplacer("2006-01-02", "*", "20060102", "*").Replace(l.Collector.Path)
+		patterns = append(patterns, pattern, pattern+".*")
+	default:
+		// app.log.1 app.log.2.gz app.log-20230101 这类
+		patterns = append(patterns, l.Collector.Path+".*", l.Collector.Path+"-*")
+	}
+
+	modTimes := make(map[string]time.Time)
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			continue
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil || !info.Mode().IsRegular() || !info.ModTime().Before(horizon) {
+				continue
+			}
+			if match == l.Tail.Filename {
+				continue
+			}
+			modTimes[match] = info.ModTime()
+		}
+	}
+
+	archives := make([]string, 0, len(modTimes))
+	for archive := range modTimes {
+		archives = append(archives, archive)
+	}
+	sort.Slice(archives, func(i, j int) bool {
+		if modTimes[archives[i]].Equal(modTimes[archives[j]]) {
+			// 修改时间相同时，app.log.2 比 app.log.1 更旧
+			return archives[i] > archives[j]
+		}
+		return modTimes[archives[i]].Before(modTimes[archives[j]])
+	})
+	return archives
+}
+
+// backfillArchive 回填一个归档，返回 false 表示收集器已经退出
+func (l *LogAgent) backfillArchive(ctx context.Context, archive string, limiter *rateLimiter, lane chan<- *Log) bool {
+	info, err := os.Stat(archive)
+	if err != nil {
+		slog.Warn("failed to stat archive", "archive", archive, "err", err)
+		return true
+	}
+	key, err := backfillArchiveKey(l.Collector.Path, archive)
+	if err != nil {
+		slog.Warn("failed to read archive", "archive", archive, "err", err)
+		return true
+	}
+	cp, ok := app.checkpoints.Get(key)
+	if !ok {
+		cp, _ = app.checkpoints.Get(legacyArchiveKey(l.Collector.Path, info))
+	}
+	progress := cp.Offset
+	if progress == backfillDone {
+		return true
+	}
+
+	// 回填和 tail 在不同的协程中处理，不能共用 tail 的 decoder
+	decoder, err := newLineDecoder(l.Collector, archive)
+	if err != nil {
+		slog.Warn("failed to create decoder", "archive", archive, "err", err)
+		return true
+	}
+
+	reader, closer, err := openArchive(archive)
+	if err != nil {
+		slog.Warn("failed to open archive", "archive", archive, "err", err)
+		return true
+	}
+	defer closer()
+
+	var lines int64
+	save := func(value int64) {
+		app.checkpoints.Put(Checkpoint{Source: key, Offset: value})
+		if err := app.checkpoints.Flush(); err != nil {
+			slog.Warn("failed to record backfill progress", "archive", archive, "err", err)
+		}
+	}
+
+	for {
+		text, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			slog.Warn("failed to read archive", "archive", archive, "err", err)
+			save(lines)
+			return true
+		}
+		if text == "" && err == io.EOF {
+			break
+		}
+		lines++
+		// 上次已经发送过的行
+		if lines <= progress {
+			continue
+		}
+
+		text = strings.TrimRight(text, "\n")
+		if !limiter.allow(len(text), l.done, ctx.Done()) {
+			save(lines - 1)
+			return false
+		}
+		for _, logmsg := range l.process(decoder, text, info.ModTime()) {
+			logmsg.Backfill = true
+			if !l.admit(ctx, logmsg) {
+				logmsg.Reset()
+				continue
+			}
+			select {
+			case lane <- logmsg:
+				logScheduler.wake()
+			case <-l.done:
+				save(lines - 1)
+				return false
+			case <-ctx.Done():
+				save(lines - 1)
+				return false
+			}
+		}
+		backfillLines.Add(l.Collector.Path, 1)
+
+		// 进度跟随检查点定期落盘
+		if lines%backfillCheckpointLines == 0 {
+			app.checkpoints.Put(Checkpoint{Source: key, Offset: lines})
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	save(backfillDone)
+	slog.Info("backfill archive finished", "archive", archive, "lines", lines)
+	return true
+}
+
+// openArchive 打开一个归档，根据文件头判断是否是 gzip 或者 zstd 压缩的
+func openArchive(archive string) (*bufio.Reader, func(), error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	buffered := bufio.NewReader(f)
+	head, _ := buffered.Peek(4)
+
+	switch {
+	case bytes.HasPrefix(head, magicGzip):
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		return bufio.NewReader(gz), func() { gz.Close(); f.Close() }, nil
+	case bytes.HasPrefix(head, magicZstd):
+		zr, err := zstd.NewReader(buffered)
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		return bufio.NewReader(zr), func() { zr.Close(); f.Close() }, nil
+	default:
+		return buffered, func() { f.Close() }, nil
+	}
+}
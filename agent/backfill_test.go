@@ -0,0 +1,207 @@
+package agent
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestOpenArchive(t *testing.T) {
+	dir := t.TempDir()
+	content := "line 1\nline 2\n"
+
+	plain := filepath.Join(dir, "app.log.1")
+	if err := os.WriteFile(plain, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	gz := filepath.Join(dir, "app.log.2.gz")
+	writeCompressed(t, gz, func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }, content)
+
+	zst := filepath.Join(dir, "app.log.3.zst")
+	writeCompressed(t, zst, func(w io.Writer) io.WriteCloser {
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return zw
+	}, content)
+
+	for _, archive := range []string{plain, gz, zst} {
+		t.Run(filepath.Base(archive), func(t *testing.T) {
+			reader, closer, err := openArchive(archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer closer()
+			got, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != content {
+				t.Errorf("openArchive() read %q, want %q", got, content)
+			}
+		})
+	}
+}
+
+func writeCompressed(t *testing.T, name string, newWriter func(io.Writer) io.WriteCloser, content string) {
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := newWriter(f)
+	if _, err := io.WriteString(w, content); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 回填和 tail 同时处理 UTF-16 的文件，需要在 -race 下运行
+func TestBackfillWithTailDecoding(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openCheckpointStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	app = NewApp(dir, store)
+
+	const lines = 200
+	path := filepath.Join(dir, "app.log")
+	archive := path + ".1"
+	writeUTF16Lines(t, archive, "backfill", lines)
+	writeUTF16Lines(t, path, "tail", lines)
+	// 归档要早于第一次开启回填的时间
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(archive, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := NewAgent(Collector{Style: "File", Path: path, Topic: "app", Encoding: EncodingUTF16LE, Backfill: true, BackfillRate: 100000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	defer stopScheduler()
+	go logScheduler.run(schedulerCtx)
+	l.Start(ctx)
+
+	want := make(map[string]bool, 2*lines)
+	for i := 0; i < lines; i++ {
+		want[fmt.Sprintf("backfill 日志 %d", i)] = true
+		want[fmt.Sprintf("tail 日志 %d", i)] = true
+	}
+	timeout := time.After(10 * time.Second)
+	for received := 0; received < 2*lines; received++ {
+		select {
+		case logmsg := <-LogChannel:
+			if !want[logmsg.Content] {
+				t.Errorf("unexpected line %q", logmsg.Content)
+			}
+			delete(want, logmsg.Content)
+			budget.release(logmsg.Size())
+		case <-timeout:
+			t.Fatalf("timeout, %d lines not received", len(want))
+		}
+	}
+
+	// 等收集器退出并关闭队列，避免影响其他测试
+	cancel()
+	for len(logScheduler.snapshot()) > 0 {
+		select {
+		case <-LogChannel:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	// 等收集器记录完检查点，之后的测试会替换 app
+	<-l.stopped
+}
+
+// writeUTF16Lines 写入 UTF-16LE 编码的日志，去掉最后一个换行符的高位字节，让文件以 '\n' 结尾
+func writeUTF16Lines(t *testing.T, name, prefix string, lines int) {
+	var content string
+	for i := 0; i < lines; i++ {
+		content += fmt.Sprintf("%s 日志 %d\n", prefix, i)
+	}
+	encoded, err := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewEncoder().String(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(encoded[:len(encoded)-1]), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackfillAfterCompression(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openCheckpointStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	app = NewApp(dir, store)
+
+	path := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	content := "line 1\nline 2\n"
+	plain := path + ".1"
+	if err := os.WriteFile(plain, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(plain, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := NewAgent(Collector{Style: "File", Path: path, Topic: "app", Backfill: true, BackfillRate: 100000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Tail.Stop()
+
+	// backfilled 回填一次，返回发送的行
+	backfilled := func() []string {
+		lane := make(chan *Log, 10)
+		l.backfill(context.Background(), lane)
+		close(lane)
+		got := make([]string, 0)
+		for logmsg := range lane {
+			got = append(got, logmsg.Content)
+			budget.release(logmsg.Size())
+		}
+		return got
+	}
+
+	if got := backfilled(); len(got) != 2 {
+		t.Fatalf("first backfill sent %q, want 2 lines", got)
+	}
+
+	// 轮转工具把 app.log.1 压缩成 app.log.2.gz，内容不变
+	compressed := path + ".2.gz"
+	writeCompressed(t, compressed, func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }, content)
+	if err := os.Remove(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(compressed, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := backfilled(); len(got) != 0 {
+		t.Errorf("backfill after compression sent %q again", got)
+	}
+}
@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"sync"
+)
+
+const defaultMemoryLimit = 64 << 20
+
+// 单个收集器在内存预算耗尽时的处理策略
+const (
+	OverflowBlock      = "block"       // 暂停读取，offset 停在原地，等待发送协程腾出空间
+	OverflowDropOldest = "drop_oldest" // 丢弃这个收集器最早还没有发送的日志
+	OverflowDropNewest = "drop_newest" // 丢弃新读到的日志
+)
+
+var (
+	// 全局的内存预算，在 App.Run 中根据配置设置上限
+	budget = newMemoryBudget(defaultMemoryLimit)
+	// 请求发送协程丢弃某个收集器最早的一条日志
+	evictChan = make(chan string, 64)
+)
+
+// memoryBudget 全局的内存预算，统计已经读出但还没有写入 Kafka 的日志字节数
+type memoryBudget struct {
+	mu    sync.Mutex
+	limit int64
+	used  int64
+	freed chan struct{} // 每次释放空间时关闭并替换，用来唤醒等待中的收集器
+}
+
+func newMemoryBudget(limit int64) *memoryBudget {
+	return &memoryBudget{limit: limit, freed: make(chan struct{})}
+}
+
+// setLimit 设置预算上限，不大于0时使用默认值
+func (b *memoryBudget) setLimit(limit int64) {
+	if limit <= 0 {
+		limit = defaultMemoryLimit
+	}
+	b.mu.Lock()
+	b.limit = limit
+	b.mu.Unlock()
+}
+
+// tryAcquire 尝试占用 n 个字节，预算不足时返回 false
+// 预算完全空闲时总是允许，避免单条超大日志永远无法发送
+func (b *memoryBudget) tryAcquire(n int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.used > 0 && b.used+n > b.limit {
+		return false
+	}
+	b.used += n
+	return true
+}
+
+// acquire 阻塞直到占用成功，done 或 cancel 关闭时放弃并返回 false
+func (b *memoryBudget) acquire(n int64, done <-chan struct{}, cancel <-chan struct{}) bool {
+	for {
+		b.mu.Lock()
+		if b.used == 0 || b.used+n <= b.limit {
+			b.used += n
+			b.mu.Unlock()
+			return true
+		}
+		freed := b.freed
+		b.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-done:
+			return false
+		case <-cancel:
+			return false
+		}
+	}
+}
+
+// forceAcquire 不检查上限直接占用，用于先放入再淘汰的场景
+func (b *memoryBudget) forceAcquire(n int64) {
+	b.mu.Lock()
+	b.used += n
+	b.mu.Unlock()
+}
+
+// release 归还 n 个字节，并唤醒等待中的收集器
+func (b *memoryBudget) release(n int64) {
+	if n <= 0 {
+		return
+	}
+	b.mu.Lock()
+	b.used -= n
+	if b.used < 0 {
+		b.used = 0
+	}
+	close(b.freed)
+	b.freed = make(chan struct{})
+	b.mu.Unlock()
+}
+
+// Used 当前占用的字节数
+func (b *memoryBudget) Used() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// Limit 预算上限
+func (b *memoryBudget) Limit() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.limit
+}
+
+// Exhausted 预算是否已经耗尽
+func (b *memoryBudget) Exhausted() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used >= b.limit
+}
@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryBudgetTryAcquire(t *testing.T) {
+	tests := []struct {
+		name string
+		used int64
+		n    int64
+		want bool
+	}{
+		{"empty", 0, 5, true},
+		{"fits", 5, 5, true},
+		{"over limit", 6, 5, false},
+		// 预算空闲时超大的日志也能通过
+		{"larger than limit when empty", 0, 20, true},
+		{"larger than limit", 1, 20, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newMemoryBudget(10)
+			b.forceAcquire(tt.used)
+			if got := b.tryAcquire(tt.n); got != tt.want {
+				t.Fatalf("tryAcquire(%d) with %d used = %v, want %v", tt.n, tt.used, got, tt.want)
+			}
+			want := tt.used
+			if tt.want {
+				want += tt.n
+			}
+			if b.Used() != want {
+				t.Errorf("used %d, want %d", b.Used(), want)
+			}
+		})
+	}
+}
+
+func TestMemoryBudgetAcquire(t *testing.T) {
+	tests := []struct {
+		name string
+		wake func(b *memoryBudget, done, cancel chan struct{})
+		want bool
+		used int64
+	}{
+		{"released", func(b *memoryBudget, done, cancel chan struct{}) { b.release(8) }, true, 5},
+		// 释放的空间不够时继续等待，直到收集器退出
+		{"released not enough", func(b *memoryBudget, done, cancel chan struct{}) {
+			b.release(1)
+			time.Sleep(20 * time.Millisecond)
+			close(done)
+		}, false, 7},
+		{"stopped", func(b *memoryBudget, done, cancel chan struct{}) { close(done) }, false, 8},
+		{"cancelled", func(b *memoryBudget, done, cancel chan struct{}) { close(cancel) }, false, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newMemoryBudget(10)
+			b.forceAcquire(8)
+			done, cancel := make(chan struct{}), make(chan struct{})
+			result := make(chan bool)
+			go func() { result <- b.acquire(5, done, cancel) }()
+
+			select {
+			case <-result:
+				t.Fatal("acquire() returned before the budget was released")
+			case <-time.After(20 * time.Millisecond):
+			}
+			tt.wake(b, done, cancel)
+			select {
+			case got := <-result:
+				if got != tt.want {
+					t.Errorf("acquire() = %v, want %v", got, tt.want)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("acquire() not woken up")
+			}
+			if b.Used() != tt.used {
+				t.Errorf("used %d, want %d", b.Used(), tt.used)
+			}
+		})
+	}
+}
+
+func TestMemoryBudgetForceAcquire(t *testing.T) {
+	b := newMemoryBudget(10)
+	b.forceAcquire(8)
+	b.forceAcquire(8)
+	if b.Used() != 16 || !b.Exhausted() {
+		t.Fatalf("used %d, exhausted %v, want 16, true", b.Used(), b.Exhausted())
+	}
+	b.release(6)
+	if b.Used() != 10 || !b.Exhausted() {
+		t.Fatalf("used %d, exhausted %v, want 10, true", b.Used(), b.Exhausted())
+	}
+	// 多归还的部分不会变成负数
+	b.release(20)
+	if b.Used() != 0 || b.Exhausted() {
+		t.Errorf("used %d, exhausted %v, want 0, false", b.Used(), b.Exhausted())
+	}
+}
@@ -0,0 +1,420 @@
+package agent
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	checkpointFileName = "checkpoint.log"
+	checkpointLockName = "checkpoint.lock"
+	// 旧版本每个文件一个的 offset 记录，打开时会导入并删除
+	legacyOffsetSuffix = ".offset"
+	// 文件开头用来计算指纹的字节数，文件不够大时不计算指纹
+	fingerprintSize = 1024
+	// 追加记录超过这个数量并且是有效记录的两倍以上时压缩
+	compactThreshold = 1000
+)
+
+// ErrCheckpointLocked 有其他进程(通常是正在运行的 bifrost)持有检查点存储
+var ErrCheckpointLocked = errors.New("checkpoint store is locked by a running bifrost, stop it first")
+
+// Checkpoint 一个数据源的读取进度
+type Checkpoint struct {
+	Source      string    `json:"source"`                // 文件路径，回填记录是带有 #backfill 后缀的收集器路径
+	Offset      int64     `json:"offset"`                // 读取到的字节偏移，回填记录是行数
+	Inode       uint64    `json:"inode,omitempty"`       // 文件的 inode，用来判断文件是否被替换
+	Fingerprint string    `json:"fingerprint,omitempty"` // 文件开头的指纹，用来判断文件是否被重写
+	UpdatedAt   time.Time `json:"updated_at"`
+	Deleted     bool      `json:"deleted,omitempty"` // 删除标记，只会出现在追加日志中
+}
+
+// IsBackfill 是否是回填的进度记录
+func (c Checkpoint) IsBackfill() bool {
+	return strings.Contains(c.Source, "#backfill")
+}
+
+// checkpointStore 所有数据源的检查点，保存在运行目录中的一个追加日志里
+// 每次落盘都会 fsync，压缩时先写临时文件再原子替换，断电最多丢失最后一条不完整的记录
+type checkpointStore struct {
+	mu      sync.Mutex
+	dir     string
+	file    *os.File
+	lock    *os.File
+	entries map[string]Checkpoint
+	dirty   map[string]bool
+	records int // 上次压缩之后追加的记录数
+}
+
+// openCheckpointStore 打开并锁定检查点存储，同一时间只能有一个进程打开
+func openCheckpointStore(dir string) (*checkpointStore, error) {
+	lock, err := os.OpenFile(filepath.Join(dir, checkpointLockName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		lock.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrCheckpointLocked
+		}
+		return nil, err
+	}
+
+	s := &checkpointStore{dir: dir, lock: lock, dirty: make(map[string]bool)}
+	entries, records, err := readCheckpointLog(filepath.Join(dir, checkpointFileName))
+	if err != nil {
+		s.unlock()
+		return nil, err
+	}
+	s.entries = entries
+	s.records = records
+
+	// 导入旧版本的 offset 文件
+	legacy, err := readLegacyOffsets(dir)
+	if err != nil {
+		s.unlock()
+		return nil, err
+	}
+	for _, cp := range legacy {
+		if _, ok := s.entries[cp.Source]; !ok {
+			s.entries[cp.Source] = cp
+		}
+	}
+
+	// 启动时压缩一次，顺便清理掉可能存在的不完整记录
+	if err := s.compact(); err != nil {
+		s.unlock()
+		return nil, err
+	}
+	for _, cp := range legacy {
+		os.Remove(legacyOffsetFileName(dir, cp.Source))
+	}
+	return s, nil
+}
+
+// loadCheckpoints 只读的加载全部检查点，不需要锁，可以在 bifrost 运行时使用
+func loadCheckpoints(dir string) ([]Checkpoint, error) {
+	entries, _, err := readCheckpointLog(filepath.Join(dir, checkpointFileName))
+	if err != nil {
+		return nil, err
+	}
+	legacy, err := readLegacyOffsets(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, cp := range legacy {
+		if _, ok := entries[cp.Source]; !ok {
+			entries[cp.Source] = cp
+		}
+	}
+	return sortedCheckpoints(entries), nil
+}
+
+// readCheckpointLog 回放追加日志，返回每个数据源最新的检查点和日志中的记录数
+func readCheckpointLog(name string) (map[string]Checkpoint, int, error) {
+	entries := make(map[string]Checkpoint)
+	f, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return entries, 0, nil
+		}
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	var records int
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var cp Checkpoint
+			// 断电时最后一条记录可能不完整，直接忽略
+			if jsonErr := json.Unmarshal(line, &cp); jsonErr == nil && cp.Source != "" {
+				records++
+				if cp.Deleted {
+					delete(entries, cp.Source)
+				} else {
+					entries[cp.Source] = cp
+				}
+			}
+		}
+		if err == io.EOF {
+			return entries, records, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// readLegacyOffsets 读取旧版本的 offset 文件，文件名是路径的 base64
+func readLegacyOffsets(dir string) ([]Checkpoint, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	result := make([]Checkpoint, 0)
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), legacyOffsetSuffix) {
+			continue
+		}
+		source, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(f.Name(), legacyOffsetSuffix))
+		if err != nil {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			continue
+		}
+		offset, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+		if err != nil {
+			continue
+		}
+		cp := Checkpoint{Source: string(source), Offset: offset}
+		if info, err := f.Info(); err == nil {
+			cp.UpdatedAt = info.ModTime()
+		}
+		result = append(result, cp)
+	}
+	return result, nil
+}
+
+func legacyOffsetFileName(dir string, source string) string {
+	return filepath.Join(dir, base64.StdEncoding.EncodeToString([]byte(source))+legacyOffsetSuffix)
+}
+
+func sortedCheckpoints(entries map[string]Checkpoint) []Checkpoint {
+	result := make([]Checkpoint, 0, len(entries))
+	for _, cp := range entries {
+		result = append(result, cp)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Source < result[j].Source
+	})
+	return result
+}
+
+// Get 读取一个数据源的检查点
+func (s *checkpointStore) Get(source string) (Checkpoint, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp, ok := s.entries[source]
+	return cp, ok
+}
+
+// All 全部的检查点
+func (s *checkpointStore) All() []Checkpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedCheckpoints(s.entries)
+}
+
+// Put 更新一个数据源的检查点，在下一次 Flush 时落盘
+func (s *checkpointStore) Put(cp Checkpoint) {
+	if cp.UpdatedAt.IsZero() {
+		cp.UpdatedAt = time.Now()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.entries[cp.Source]; ok && old.Offset == cp.Offset && old.Inode == cp.Inode && old.Fingerprint == cp.Fingerprint {
+		return
+	}
+	s.entries[cp.Source] = cp
+	s.dirty[cp.Source] = true
+}
+
+// Delete 删除一个数据源的检查点，马上落盘
+func (s *checkpointStore) Delete(source string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[source]; !ok {
+		return nil
+	}
+	delete(s.entries, source)
+	delete(s.dirty, source)
+	return s.append([]Checkpoint{{Source: source, Deleted: true, UpdatedAt: time.Now()}})
+}
+
+// Flush 把有变化的检查点追加到日志并 fsync，日志过长时压缩
+func (s *checkpointStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.dirty) == 0 {
+		return nil
+	}
+
+	changed := make([]Checkpoint, 0, len(s.dirty))
+	for source := range s.dirty {
+		if cp, ok := s.entries[source]; ok {
+			changed = append(changed, cp)
+		}
+	}
+	if err := s.append(changed); err != nil {
+		return err
+	}
+	s.dirty = make(map[string]bool)
+
+	if s.records > compactThreshold && s.records > 2*len(s.entries) {
+		return s.compact()
+	}
+	return nil
+}
+
+// append 追加记录，调用方需要持有锁
+func (s *checkpointStore) append(cps []Checkpoint) error {
+	buf := make([]byte, 0, 128*len(cps))
+	for _, cp := range cps {
+		line, err := json.Marshal(cp)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	if _, err := s.file.Write(buf); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.records += len(cps)
+	return nil
+}
+
+// compact 把当前的检查点写入临时文件，fsync 之后原子替换掉追加日志，调用方需要持有锁或者独占存储
+func (s *checkpointStore) compact() error {
+	name := filepath.Join(s.dir, checkpointFileName)
+	tmp, err := os.CreateTemp(s.dir, checkpointFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	cps := sortedCheckpoints(s.entries)
+	for _, cp := range cps {
+		line, err := json.Marshal(cp)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		writer.Write(line)
+		writer.WriteByte('\n')
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+	if err := syncDir(s.dir); err != nil {
+		return err
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file, err = os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.records = len(cps)
+	return nil
+}
+
+// Close 落盘并释放锁
+func (s *checkpointStore) Close() error {
+	err := s.Flush()
+	s.mu.Lock()
+	if s.file != nil {
+		if closeErr := s.file.Close(); err == nil {
+			err = closeErr
+		}
+		s.file = nil
+	}
+	s.mu.Unlock()
+	s.unlock()
+	return err
+}
+
+func (s *checkpointStore) unlock() {
+	syscall.Flock(int(s.lock.Fd()), syscall.LOCK_UN)
+	s.lock.Close()
+}
+
+// syncDir 改名之后 fsync 目录，保证改名本身也落盘了
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// fileIdentity 文件的 inode 和开头的指纹，文件不够大时指纹为空
+func fileIdentity(name string) (uint64, string) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, ""
+	}
+	defer f.Close()
+
+	var ino uint64
+	if info, err := f.Stat(); err == nil {
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			ino = stat.Ino
+		}
+	}
+
+	head := make([]byte, fingerprintSize)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return ino, ""
+	}
+	sum := sha256.Sum256(head)
+	return ino, hex.EncodeToString(sum[:8])
+}
+
+// resumeOffset 判断文件是否还是记录检查点时的那个文件，是的话返回记录的 offset，否则从头读取
+func resumeOffset(cp Checkpoint, name string) (int64, string) {
+	info, err := os.Stat(name)
+	if err != nil {
+		// 文件还不存在，等它出现后从头读取
+		return 0, "file not exist"
+	}
+	ino, fingerprint := fileIdentity(name)
+	switch {
+	case cp.Inode != 0 && ino != 0 && cp.Inode != ino:
+		return 0, fmt.Sprintf("inode changed from %d to %d", cp.Inode, ino)
+	case cp.Fingerprint != "" && fingerprint != "" && cp.Fingerprint != fingerprint:
+		return 0, "fingerprint changed"
+	case info.Size() < cp.Offset:
+		return 0, fmt.Sprintf("file truncated to %d", info.Size())
+	}
+	return cp.Offset, ""
+}
@@ -0,0 +1,195 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckpointStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := openCheckpointStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Put(Checkpoint{Source: "/var/log/a.log", Offset: 10})
+	store.Put(Checkpoint{Source: "/var/log/b.log", Offset: 20})
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	store.Put(Checkpoint{Source: "/var/log/a.log", Offset: 30})
+	if err := store.Delete("/var/log/b.log"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 持有锁的时候不能再次打开
+	if _, err := openCheckpointStore(dir); err != ErrCheckpointLocked {
+		t.Fatalf("open locked store: got %v, want %v", err, ErrCheckpointLocked)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟断电时写了一半的记录
+	f, err := os.OpenFile(filepath.Join(dir, checkpointFileName), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"source":"/var/log/a.log","off`)
+	f.Close()
+
+	store, err = openCheckpointStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if cp, ok := store.Get("/var/log/a.log"); !ok || cp.Offset != 30 {
+		t.Errorf("a.log: got %+v %v, want offset 30", cp, ok)
+	}
+	if _, ok := store.Get("/var/log/b.log"); ok {
+		t.Error("b.log should be deleted")
+	}
+
+	// 打开时已经压缩，只剩下一条有效记录
+	content, err := os.ReadFile(filepath.Join(dir, checkpointFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(content), "\n"); lines != 1 {
+		t.Errorf("compacted log has %d lines, want 1", lines)
+	}
+}
+
+func TestCheckpointStoreLegacyImport(t *testing.T) {
+	dir := t.TempDir()
+	legacy := legacyOffsetFileName(dir, "/var/log/old.log")
+	if err := os.WriteFile(legacy, []byte("1024"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := openCheckpointStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if cp, ok := store.Get("/var/log/old.log"); !ok || cp.Offset != 1024 {
+		t.Errorf("got %+v %v, want offset 1024", cp, ok)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Error("legacy offset file should be removed after import")
+	}
+}
+
+func TestResumeOffset(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(name, []byte(strings.Repeat("a", fingerprintSize+100)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ino, fingerprint := fileIdentity(name)
+	cp := Checkpoint{Source: name, Offset: 100, Inode: ino, Fingerprint: fingerprint}
+
+	if offset, reason := resumeOffset(cp, name); offset != 100 {
+		t.Errorf("same file: got %d (%s), want 100", offset, reason)
+	}
+
+	// 同一个 inode 被重写
+	if err := os.WriteFile(name, []byte(strings.Repeat("b", fingerprintSize+100)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if offset, _ := resumeOffset(cp, name); offset != 0 {
+		t.Errorf("rewritten file: got %d, want 0", offset)
+	}
+
+	// 被截断
+	if err := os.WriteFile(name, []byte("short"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if offset, _ := resumeOffset(Checkpoint{Source: name, Offset: 100, Inode: ino}, name); offset != 0 {
+		t.Errorf("truncated file: got %d, want 0", offset)
+	}
+}
+
+func TestCheckpointAfterDelivery(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openCheckpointStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	app = NewApp(dir, store)
+
+	path := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(path, []byte("a\nbb\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewAgent(Collector{Style: "File", Path: path, Topic: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	defer stopScheduler()
+	go logScheduler.run(schedulerCtx)
+	l.Start(ctx)
+	defer func() {
+		cancel()
+		for len(logScheduler.snapshot()) > 0 {
+			select {
+			case <-LogChannel:
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		// 等收集器记录完检查点，之后的测试会替换 app
+		<-l.stopped
+	}()
+
+	// receive 读出 n 行放进一个批次，还没有写入
+	receive := func(n int) *messageBatch {
+		batch := newMessageBatch(n)
+		for i := 0; i < n; i++ {
+			select {
+			case logmsg := <-LogChannel:
+				budget.release(logmsg.Size())
+				batch.advance(logmsg)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timeout, %d lines not received", n-i)
+			}
+		}
+		return batch
+	}
+	checkpointOffset := func() int64 {
+		if err := l.checkpoint(); err != nil {
+			t.Fatal(err)
+		}
+		cp, _ := app.checkpoints.Get(path)
+		return cp.Offset
+	}
+
+	first := receive(2)
+	if offset := checkpointOffset(); offset != 0 {
+		t.Errorf("checkpoint before delivery = %d, want 0", offset)
+	}
+	first.commit()
+	if offset := checkpointOffset(); offset != 5 {
+		t.Errorf("checkpoint after delivery = %d, want 5", offset)
+	}
+
+	// 截断后 tail 从头读取，新文件的位置从 0 开始计算
+	if err := os.WriteFile(path, []byte("ccc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	second := receive(1)
+	second.commit()
+	// 旧文件的批次晚到也不能把位置推回旧文件
+	first.commit()
+	if offset := checkpointOffset(); offset != 4 {
+		t.Errorf("checkpoint after truncation = %d, want 4", offset)
+	}
+}
@@ -1,8 +1,92 @@
 package agent
 
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Kafka 的 topic 只能由字母、数字、点、下划线和中划线组成，最长249个字符
+var topicPattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,249}$`)
+
 type Collector struct {
-	Style string `json:"style" gird_column:"日志规则" gird_sort:"4"`
-	Path  string `json:"path" gird_column:"路径" gird_sort:"1"`
-	Topic string `json:"topic" gird_column:"日志主题" gird_sort:"2"`
-	Exist string `json:"_" gird_column:"是否存在" gird_sort:"4"`
+	Style    string `json:"style" gird_column:"日志规则" gird_sort:"4"`
+	Path     string `json:"path" gird_column:"路径" gird_sort:"1"`
+	Topic    string `json:"topic" gird_column:"日志主题" gird_sort:"2"`
+	Exist    string `json:"_" gird_column:"是否存在" gird_sort:"4"`
+	Overflow string `json:"overflow,omitempty"` // 内存预算耗尽时的策略: block(默认) drop_oldest drop_newest
+
+	// 限速，不配置或者为0表示不限速
+	RateLines  int    `json:"rate_lines,omitempty"`  // 每秒最多发送的条数
+	RateBytes  int    `json:"rate_bytes,omitempty"`  // 每秒最多发送的字节数
+	BurstLines int    `json:"burst_lines,omitempty"` // 条数突发上限，默认等于 rate_lines
+	BurstBytes int    `json:"burst_bytes,omitempty"` // 字节突发上限，默认等于 rate_bytes
+	OverLimit  string `json:"over_limit,omitempty"`  // 超过限速时的处理: block(默认) sample drop
+	SampleRate int    `json:"sample_rate,omitempty"` // sample 模式下每多少条保留一条，默认10
+
+	// 超长日志，不配置或者为0表示不限制
+	MaxLineBytes int    `json:"max_line_bytes,omitempty"` // 单条日志的最大字节数
+	LineMode     string `json:"line_mode,omitempty"`      // 超长时的处理: truncate(默认) split
+
+	// 编码转换，不配置时原样发送
+	Encoding string `json:"encoding,omitempty"` // 文件编码: utf-8 gbk gb18030 utf-16 utf-16le utf-16be
+	Invalid  string `json:"invalid,omitempty"`  // 非法字节序列的处理: replace(默认) drop pass
+
+	// 回填已经轮转出去的历史归档
+	Backfill     bool `json:"backfill,omitempty"`      // 是否回填
+	BackfillRate int  `json:"backfill_rate,omitempty"` // 回填时每秒最多发送的条数，默认1000
+}
+
+// Validate 检查收集器的配置，写入 etcd 之前调用
+func (c Collector) Validate() error {
+	switch c.Style {
+	case "File":
+	case "Date":
+		if !(strings.Contains(c.Path, "2006-01-02") || strings.Contains(c.Path, "20060102")) {
+			return fmt.Errorf("path(%s) of Date collector must contain 2006-01-02 or 20060102", c.Path)
+		}
+	default:
+		return fmt.Errorf("style(%s) must be File or Date", c.Style)
+	}
+
+	if !filepath.IsAbs(c.Path) {
+		return fmt.Errorf("path(%s) must be absolute", c.Path)
+	}
+	if strings.ContainsAny(c.Path, "*?[") {
+		return fmt.Errorf("path(%s) can not be a glob pattern", c.Path)
+	}
+	if filepath.Clean(c.Path) != c.Path {
+		return fmt.Errorf("path(%s) is not clean, use %s", c.Path, filepath.Clean(c.Path))
+	}
+
+	if !topicPattern.MatchString(c.Topic) || c.Topic == "." || c.Topic == ".." {
+		return fmt.Errorf("topic(%s) must be 1-249 characters of [a-zA-Z0-9._-]", c.Topic)
+	}
+
+	switch c.Overflow {
+	case "", OverflowBlock, OverflowDropOldest, OverflowDropNewest:
+	default:
+		return fmt.Errorf("overflow(%s) must be one of block, drop_oldest, drop_newest", c.Overflow)
+	}
+	switch c.OverLimit {
+	case "", OverLimitBlock, OverLimitSample, OverLimitDrop:
+	default:
+		return fmt.Errorf("over_limit(%s) must be one of block, sample, drop", c.OverLimit)
+	}
+	switch c.LineMode {
+	case "", LineModeTruncate, LineModeSplit:
+	default:
+		return fmt.Errorf("line_mode(%s) must be one of truncate, split", c.LineMode)
+	}
+	if c.RateLines < 0 || c.RateBytes < 0 || c.BurstLines < 0 || c.BurstBytes < 0 || c.SampleRate < 0 ||
+		c.MaxLineBytes < 0 || c.BackfillRate < 0 {
+		return fmt.Errorf("rates and limits of collector can not be negative")
+	}
+
+	// 编码和非法字节的处理方式交给解码器检查
+	if _, err := newLineDecoder(c, ""); err != nil {
+		return err
+	}
+	return nil
 }
@@ -3,7 +3,7 @@ package agent
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 
 	"github.com/y7ut/logagent/etcd"
 	clientv3 "go.etcd.io/etcd/client/v3"
@@ -23,7 +23,7 @@ func getEtcdCollectorConfig() (collectors []Collector, err error) {
 	if err != nil {
 		return collectors, err
 	}
-	log.Println("load config success!")
+	slog.Info("load config success", "collectors", len(collectors))
 	return collectors, nil
 }
 
@@ -32,25 +32,33 @@ func watchEtcdConfig(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Close Etcd Watching!")
+			slog.Info("close etcd watching")
 			return
 		case confResp := <-etcd.WatchLogConfToEtcd():
 			for _, event := range confResp.Events {
 				switch event.Type {
 				case clientv3.EventTypePut:
-					diff, status, err := getCollectorChangeWithEvent(event)
-					log.Printf("ETCD watch %s is Happend", status)
+					added, removed, status, err := getCollectorChangeWithEvent(event)
+					slog.Info("etcd watch event", "type", status)
 					if err != nil {
-						log.Println("Get Collector Chnage Event Info Error:", err)
+						slog.Error("failed to get collector change", "err", err)
 						continue
 					}
-					switch status {
-					default:
-						continue
-					case "DEL":
-						CloseChan <- diff
-					case "PUT":
-						StartChan <- diff
+					closing := make([]*LogAgent, 0, len(removed))
+					for _, collector := range removed {
+						if old, ok := app.getAgent(collector.Path); ok {
+							closing = append(closing, old)
+						}
+						CloseChan <- collector
+					}
+					// 修改的收集器先关闭旧的，等它记录完 offset 再启动新的
+					if len(added) > 0 {
+						for _, old := range closing {
+							old.wait(ctx)
+						}
+					}
+					for _, collector := range added {
+						StartChan <- collector
 					}
 				case clientv3.EventTypeDelete:
 					// 节点开启的时候不会出现突然删除的情况所以不考虑
@@ -63,11 +71,12 @@ func watchEtcdConfig(ctx context.Context) {
 }
 
 // getCollectorChangeWithEvent 获取Agent 中 Collector 的变更
-// 有三种类型 changeType
+// 有四种类型 changeType
 // 1: CREATED  初始化, 一般指新增了 Agent，还没有注册 Collector
 // 2: PUT      新增了 Collector
 // 3: DEL      删除了 Collector
-func getCollectorChangeWithEvent(event *clientv3.Event) (different Collector, changeType string, err error) {
+// 4: EDIT     修改了 Collector，旧的在 removed 中，新的在 added 中
+func getCollectorChangeWithEvent(event *clientv3.Event) (added []Collector, removed []Collector, changeType string, err error) {
 
 	var currentCollectors []Collector
 
@@ -75,7 +84,7 @@ func getCollectorChangeWithEvent(event *clientv3.Event) (different Collector, ch
 
 	err = json.Unmarshal(changedConf, &currentCollectors)
 	if err != nil {
-		return different, changeType, err
+		return added, removed, changeType, err
 	}
 
 	var oldCollector []Collector
@@ -90,41 +99,40 @@ func getCollectorChangeWithEvent(event *clientv3.Event) (different Collector, ch
 			changeType = "CREATED"
 			err = nil
 		}
-		return different, changeType, err
+		return added, removed, changeType, err
 	}
 
 	err = json.Unmarshal(oldValue, &oldCollector)
 
 	if err != nil {
-		return different, changeType, err
+		return added, removed, changeType, err
 	}
 
-	var set = make(map[Collector]bool)
-
-	if len(oldCollector)-len(currentCollectors) < 0 {
-		changeType = "PUT"
-
-		for _, item := range oldCollector {
-			set[item] = true
-		}
-
-		for _, item := range currentCollectors {
-			if !set[item] {
-				different = item
-			}
+	var oldSet = make(map[Collector]bool)
+	for _, item := range oldCollector {
+		oldSet[item] = true
+	}
+	var currentSet = make(map[Collector]bool)
+	for _, item := range currentCollectors {
+		currentSet[item] = true
+		if !oldSet[item] {
+			added = append(added, item)
 		}
-	} else {
-		changeType = "DEL"
-		for _, item := range currentCollectors {
-			set[item] = true
+	}
+	for _, item := range oldCollector {
+		if !currentSet[item] {
+			removed = append(removed, item)
 		}
+	}
 
-		for _, item := range oldCollector {
-			if !set[item] {
-				different = item
-			}
-		}
+	switch {
+	case len(added) > 0 && len(removed) > 0:
+		changeType = "EDIT"
+	case len(added) > 0:
+		changeType = "PUT"
+	case len(removed) > 0:
+		changeType = "DEL"
 	}
 
-	return different, changeType, err
+	return added, removed, changeType, err
 }
@@ -0,0 +1,138 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/y7ut/logagent/conf"
+	"github.com/y7ut/logagent/pkg/file"
+)
+
+// deadLetter 死信，Kafka 永久拒绝或者重试耗尽的消息会被送到这里
+// 优先写入死信 Topic，失败或者没有配置时写入本地文件，都没有配置时只记录日志
+type deadLetter struct {
+	writer *kafka.Writer
+	topic  string
+	file   *os.File
+}
+
+// deadLetterRecord 死信文件中的一行
+type deadLetterRecord struct {
+	Time    time.Time         `json:"time"`
+	Topic   string            `json:"topic"`
+	Key     string            `json:"key"`
+	Value   string            `json:"value"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Reason  string            `json:"reason"`
+}
+
+func newDeadLetter(writer *kafka.Writer, c conf.DeadLetter) (*deadLetter, error) {
+	d := &deadLetter{writer: writer, topic: c.Topic}
+	if c.File == "" {
+		return d, nil
+	}
+	if err := file.PathExistOrCreate(filepath.Dir(c.File)); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(c.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	d.file = f
+	return d, nil
+}
+
+// send 把一条消息连同失败原因送进死信
+func (d *deadLetter) send(ctx context.Context, msg kafka.Message, reason error) {
+	deadLetterMessages.Add(1)
+	collectorErrors.Add(string(msg.Key), 1)
+
+	if d.topic != "" && msg.Topic != d.topic && ctx.Err() == nil {
+		headers := make([]kafka.Header, 0, len(msg.Headers)+2)
+		headers = append(headers, msg.Headers...)
+		headers = append(headers,
+			kafka.Header{Key: "dead_letter_topic", Value: []byte(msg.Topic)},
+			kafka.Header{Key: "dead_letter_reason", Value: []byte(reason.Error())},
+		)
+		err := d.writer.WriteMessages(ctx, kafka.Message{
+			Key:     msg.Key,
+			Value:   msg.Value,
+			Topic:   d.topic,
+			Headers: headers,
+		})
+		if err == nil {
+			return
+		}
+		slog.Error("failed to write dead letter topic", "topic", d.topic, "err", err)
+	}
+	d.store(msg, reason)
+}
+
+// spill Kafka 不可用时使用，跳过死信 Topic 直接写入文件
+func (d *deadLetter) spill(msg kafka.Message, reason error) {
+	deadLetterMessages.Add(1)
+	collectorErrors.Add(string(msg.Key), 1)
+	d.store(msg, reason)
+}
+
+// store 写入死信文件，没有配置文件时只记录日志
+func (d *deadLetter) store(msg kafka.Message, reason error) {
+	if d.file != nil {
+		err := d.writeFile(msg, reason)
+		if err == nil {
+			return
+		}
+		slog.Error("failed to write dead letter file", "file", d.file.Name(), "err", err)
+	}
+
+	slog.Error("drop message", "topic", msg.Topic, "key", string(msg.Key), "reason", reason)
+}
+
+func (d *deadLetter) writeFile(msg kafka.Message, reason error) error {
+	record := deadLetterRecord{
+		Time:   time.Now(),
+		Topic:  msg.Topic,
+		Key:    string(msg.Key),
+		Value:  string(msg.Value),
+		Reason: reason.Error(),
+	}
+	if len(msg.Headers) > 0 {
+		record.Headers = make(map[string]string, len(msg.Headers))
+		for _, h := range msg.Headers {
+			record.Headers[h.Key] = string(h.Value)
+		}
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = d.file.Write(append(line, '\n'))
+	return err
+}
+
+func (d *deadLetter) Close() error {
+	if d.file == nil {
+		return nil
+	}
+	return d.file.Close()
+}
+
+// retryExhaustedError 重试次数用完的临时错误
+type retryExhaustedError struct {
+	attempts int
+	err      error
+}
+
+func (e retryExhaustedError) Error() string {
+	return fmt.Sprintf("retry %d times: %v", e.attempts, e.err)
+}
+
+func (e retryExhaustedError) Unwrap() error {
+	return e.err
+}
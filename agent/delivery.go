@@ -0,0 +1,213 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/y7ut/logagent/conf"
+)
+
+const (
+	defaultMaxRetries   = 3
+	defaultRetryBackoff = time.Second
+	maxRetryBackoff     = 30 * time.Second
+	// 连不上 Kafka 超过这个时间后，每次重试都打印错误日志
+	kafkaUnreachableAlert = time.Minute
+)
+
+// 写入失败的分类
+const (
+	errorPermanent  = iota // Kafka 明确拒绝，比如消息过大、Topic 非法，直接送进死信
+	errorTemporary         // Kafka 返回的可重试错误，比如 Leader 切换，重试耗尽后送进死信
+	errorConnection        // 连不上 Kafka 等整体故障，一直重试，依靠内存预算让收集器暂停
+)
+
+// kafkaDownSince 连不上 Kafka 的开始时间(UnixNano)，0 表示 Kafka 正常
+var kafkaDownSince atomic.Int64
+
+// kafkaUnreachableFor 连不上 Kafka 已经多久了
+func kafkaUnreachableFor() time.Duration {
+	since := kafkaDownSince.Load()
+	if since == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, since))
+}
+
+// errDeliverTimeout 退出时等待超时，还没有写入的消息直接写入死信文件
+var errDeliverTimeout = errors.New("kafka is unavailable when bifrost exits")
+
+// delivery 负责把批次写入 Kafka，并逐条检查失败原因，不让一条坏消息拖垮整个批次
+type delivery struct {
+	writer     *kafka.Writer
+	dead       *deadLetter
+	maxRetries int
+	backoff    time.Duration
+}
+
+func newDelivery(writer *kafka.Writer, dead *deadLetter, c conf.Kafka) *delivery {
+	d := &delivery{writer: writer, dead: dead, maxRetries: c.MaxRetries, backoff: c.RetryBackoff}
+	if d.maxRetries <= 0 {
+		d.maxRetries = defaultMaxRetries
+	}
+	if d.backoff <= 0 {
+		d.backoff = defaultRetryBackoff
+	}
+	return d
+}
+
+// deliver 写入一组消息，直到全部成功或者进入死信
+// ctx 结束后不再重试，剩下的消息跳过死信 Topic 直接写入死信文件
+func (d *delivery) deliver(ctx context.Context, msgs []kafka.Message) {
+	attempt := 0
+	backoff := d.backoff
+	var lastErr error
+	for len(msgs) > 0 {
+		if ctx.Err() != nil {
+			reason := errDeliverTimeout
+			if lastErr != nil {
+				reason = fmt.Errorf("%w: %v", errDeliverTimeout, lastErr)
+			}
+			slog.Warn("give up retrying, write to dead letter file", "messages", len(msgs), "reason", reason)
+			for _, msg := range msgs {
+				d.dead.spill(msg, reason)
+			}
+			return
+		}
+
+		err := d.writer.WriteMessages(ctx, msgs...)
+		if err == nil {
+			kafkaDownSince.Store(0)
+			return
+		}
+		lastErr = err
+
+		retry := make([]kafka.Message, 0)
+		reasons := make([]error, 0)
+		limited := false
+		unreachable := false
+
+		var tooLarge kafka.MessageTooLargeError
+		var writeErrors kafka.WriteErrors
+		switch {
+		case errors.As(err, &tooLarge):
+			// 过大的消息会让整个批次都写不进去，把它拿出来，剩下的马上重新写
+			d.dead.send(ctx, tooLarge.Message, err)
+			msgs = tooLarge.Remaining
+			continue
+		case errors.As(err, &writeErrors) && len(writeErrors) == len(msgs):
+			for i, e := range writeErrors {
+				if e == nil {
+					continue
+				}
+				switch classifyError(e) {
+				case errorPermanent:
+					d.dead.send(ctx, msgs[i], e)
+					continue
+				case errorTemporary:
+					limited = true
+				case errorConnection:
+					unreachable = true
+				}
+				retry = append(retry, msgs[i])
+				reasons = append(reasons, e)
+			}
+		default:
+			// 整个请求失败了，多个 Topic 混在一起时按 Topic 分开写，避免一个不存在的 Topic 拖累其他消息
+			if groups := groupByTopic(msgs); len(groups) > 1 {
+				for _, group := range groups {
+					d.deliver(ctx, group)
+				}
+				return
+			}
+			class := classifyError(err)
+			for _, msg := range msgs {
+				if class == errorPermanent {
+					d.dead.send(ctx, msg, err)
+					continue
+				}
+				retry = append(retry, msg)
+				reasons = append(reasons, err)
+			}
+			limited = class == errorTemporary
+			unreachable = class == errorConnection
+		}
+
+		if len(retry) == 0 {
+			return
+		}
+
+		// 只有 Kafka 返回的临时错误才计算重试次数，连接故障一直重试
+		if limited {
+			attempt++
+			if attempt > d.maxRetries {
+				for i, msg := range retry {
+					d.dead.send(ctx, msg, retryExhaustedError{attempts: d.maxRetries, err: reasons[i]})
+				}
+				return
+			}
+		}
+
+		retriedMessages.Add(int64(len(retry)))
+		if unreachable {
+			connectionErrors.Add(1)
+			kafkaDownSince.CompareAndSwap(0, time.Now().UnixNano())
+		}
+		// 配置错误的地址也会一直重试，长时间连不上时要让人看到
+		if down := kafkaUnreachableFor(); down > kafkaUnreachableAlert {
+			slog.Error("kafka unreachable, retry messages", "messages", len(retry), "for", down.Round(time.Second), "backoff", backoff, "reason", reasons[0])
+		} else {
+			slog.Warn("retry messages", "messages", len(retry), "backoff", backoff, "reason", reasons[0])
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+		}
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+		msgs = retry
+	}
+}
+
+// classifyError 判断一个写入错误是否值得重试
+func classifyError(err error) int {
+	var kafkaError kafka.Error
+	if errors.As(err, &kafkaError) {
+		switch kafkaError {
+		case kafka.UnknownTopicOrPartition, kafka.InvalidTopic:
+			// kafka-go 认为 Topic 不存在可以重试，但是没有开启自动创建时重试多少次都不会成功
+			return errorPermanent
+		}
+		if kafkaError.Temporary() {
+			return errorTemporary
+		}
+		return errorPermanent
+	}
+	var tooLarge kafka.MessageTooLargeError
+	if errors.As(err, &tooLarge) {
+		return errorPermanent
+	}
+	return errorConnection
+}
+
+// groupByTopic 按 Topic 分组，保持消息原本的先后顺序
+func groupByTopic(msgs []kafka.Message) [][]kafka.Message {
+	index := make(map[string]int)
+	groups := make([][]kafka.Message, 0)
+	for _, msg := range msgs {
+		i, ok := index[msg.Topic]
+		if !ok {
+			i = len(groups)
+			index[msg.Topic] = i
+			groups = append(groups, make([]kafka.Message, 0))
+		}
+		groups[i] = append(groups[i], msg)
+	}
+	return groups
+}
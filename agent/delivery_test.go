@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/y7ut/logagent/conf"
+)
+
+func TestDeliverGivesUpAfterDeadline(t *testing.T) {
+	deadFile := filepath.Join(t.TempDir(), "dead_letter.log")
+	// 没有监听的端口，模拟 Kafka 不可用
+	writer := &kafka.Writer{Addr: kafka.TCP("127.0.0.1:1"), BatchTimeout: time.Millisecond}
+	defer writer.Close()
+	dead, err := newDeadLetter(writer, conf.DeadLetter{Topic: "dead", File: deadFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := newDelivery(writer, dead, conf.Kafka{RetryBackoff: 50 * time.Millisecond})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	msgs := []kafka.Message{
+		{Topic: "app", Key: []byte("/var/log/a.log"), Value: []byte("a")},
+		{Topic: "app", Key: []byte("/var/log/a.log"), Value: []byte("b")},
+	}
+	kafkaDownSince.Store(0)
+	start := time.Now()
+	d.deliver(ctx, msgs)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("deliver() returned after %s, want soon after the deadline", elapsed)
+	}
+	// 连不上 Kafka 的时间要能从指标中看到
+	if kafkaUnreachableFor() == 0 {
+		t.Error("kafka is unreachable but kafkaUnreachableFor() = 0")
+	}
+	if err := dead.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(deadFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	values := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record deadLetterRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.Topic != "app" || record.Reason == "" {
+			t.Errorf("unexpected dead letter record %+v", record)
+		}
+		values = append(values, record.Value)
+	}
+	if len(values) != 2 || values[0] != "a" || values[1] != "b" {
+		t.Errorf("dead letter values = %q, want [a b]", values)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"leader not available", kafka.LeaderNotAvailable, errorTemporary},
+		{"unknown topic", kafka.UnknownTopicOrPartition, errorPermanent},
+		{"wrapped unknown topic", fmt.Errorf("write: %w", kafka.UnknownTopicOrPartition), errorPermanent},
+		{"wrapped temporary", fmt.Errorf("write: %w", kafka.NotEnoughReplicas), errorTemporary},
+		{"message size too large", kafka.MessageSizeTooLarge, errorPermanent},
+		{"invalid topic", kafka.InvalidTopic, errorPermanent},
+		{"message too large", kafka.MessageTooLargeError{}, errorPermanent},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connection refused")}, errorConnection},
+		{"eof", io.EOF, errorConnection},
+		{"deadline", context.DeadlineExceeded, errorConnection},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyError(tt.err); got != tt.want {
+				t.Errorf("classifyError(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupByTopic(t *testing.T) {
+	msgs := []kafka.Message{
+		{Topic: "a", Value: []byte("1")},
+		{Topic: "b", Value: []byte("2")},
+		{Topic: "a", Value: []byte("3")},
+		{Topic: "c", Value: []byte("4")},
+		{Topic: "b", Value: []byte("5")},
+	}
+	tests := []struct {
+		name string
+		msgs []kafka.Message
+		want [][]string
+	}{
+		{"empty", nil, [][]string{}},
+		{"single topic", msgs[:1], [][]string{{"1"}}},
+		// 按照 Topic 第一次出现的顺序分组，组内保持原来的顺序
+		{"mixed topics", msgs, [][]string{{"1", "3"}, {"2", "5"}, {"4"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([][]string, 0)
+			for _, group := range groupByTopic(tt.msgs) {
+				values := make([]string, 0, len(group))
+				for _, msg := range group {
+					if msg.Topic != group[0].Topic {
+						t.Errorf("topic %s in the group of %s", msg.Topic, group[0].Topic)
+					}
+					values = append(values, string(msg.Value))
+				}
+				got = append(got, values)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groupByTopic() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// 日志文件的编码
+const (
+	EncodingUTF8    = "utf-8"
+	EncodingGBK     = "gbk"
+	EncodingGB18030 = "gb18030"
+	EncodingUTF16   = "utf-16" // 根据 BOM 判断字节序，没有 BOM 时按小端处理
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+)
+
+// 遇到非法字节序列时的处理
+const (
+	InvalidReplace = "replace" // 替换成 U+FFFD
+	InvalidDrop    = "drop"    // 丢掉非法的部分
+	InvalidPass    = "pass"    // 这一行原样发送，不做转换
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// lineDecoder 把 tail 读到的一行按照收集器的编码转成 UTF-8
+type lineDecoder struct {
+	decoder *encoding.Decoder // 为 nil 时表示本身就是 UTF-8
+	utf16   int               // 0 不是 UTF-16，1 小端，2 大端
+	invalid string
+}
+
+// newLineDecoder 收集器没有配置编码时返回 nil，不做任何转换
+func newLineDecoder(c Collector, fileName string) (*lineDecoder, error) {
+	if c.Encoding == "" {
+		return nil, nil
+	}
+
+	d := &lineDecoder{invalid: c.Invalid}
+	switch d.invalid {
+	case "":
+		d.invalid = InvalidReplace
+	case InvalidReplace, InvalidDrop, InvalidPass:
+	default:
+		return nil, fmt.Errorf("logagent invalid policy(%s) format error", c.Invalid)
+	}
+
+	switch strings.ToLower(c.Encoding) {
+	case EncodingUTF8, "utf8":
+	case EncodingGBK:
+		d.decoder = simplifiedchinese.GBK.NewDecoder()
+	case EncodingGB18030:
+		d.decoder = simplifiedchinese.GB18030.NewDecoder()
+	case EncodingUTF16:
+		d.utf16 = 1
+		if bytes.Equal(readBOM(fileName), bomUTF16BE) {
+			d.utf16 = 2
+		}
+	case EncodingUTF16LE:
+		d.utf16 = 1
+	case EncodingUTF16BE:
+		d.utf16 = 2
+	default:
+		return nil, fmt.Errorf("logagent encoding(%s) format error", c.Encoding)
+	}
+
+	switch d.utf16 {
+	case 1:
+		d.decoder = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewDecoder()
+	case 2:
+		d.decoder = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewDecoder()
+	}
+	return d, nil
+}
+
+// readBOM 读取文件开头可能存在的 BOM，文件还不存在时返回 nil
+func readBOM(fileName string) []byte {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	head := make([]byte, 3)
+	n, _ := f.Read(head)
+	head = head[:n]
+	for _, bom := range [][]byte{bomUTF8, bomUTF16LE, bomUTF16BE} {
+		if bytes.HasPrefix(head, bom) {
+			return bom
+		}
+	}
+	return nil
+}
+
+// decode 转换一行日志
+func (d *lineDecoder) decode(text string) string {
+	raw := text
+	if d.utf16 > 0 {
+		text = alignUTF16(text, d.utf16 == 2)
+	}
+
+	if d.decoder != nil {
+		decoded, err := d.decoder.String(text)
+		if err != nil {
+			return raw
+		}
+		text = decoded
+	}
+	// BOM 只会出现在文件的第一行，UTF-16 的换行符还会留下一个 \r
+	text = strings.TrimPrefix(text, "\uFEFF")
+	if d.utf16 > 0 {
+		text = strings.TrimSuffix(text, "\r")
+	}
+
+	switch d.invalid {
+	case InvalidPass:
+		if d.decoder != nil && strings.ContainsRune(text, utf8.RuneError) {
+			return raw
+		}
+		return text
+	case InvalidDrop:
+		if d.decoder != nil {
+			text = strings.ReplaceAll(text, string(utf8.RuneError), "")
+		}
+		return strings.ToValidUTF8(text, "")
+	default:
+		return strings.ToValidUTF8(text, string(utf8.RuneError))
+	}
+}
+
+// alignUTF16 tail 按照 '\n' 这个字节切分行
+// UTF-16 的换行符占两个字节，小端时下一行开头会多出一个 0x00，大端时这一行末尾会多出一个 0x00
+// 注意低位字节恰好是 0x0A 的字符也会被 tail 错误的切开，这种情况无法恢复
+func alignUTF16(text string, bigEndian bool) string {
+	if len(text)%2 == 0 {
+		return text
+	}
+	if bigEndian {
+		return strings.TrimSuffix(text, "\x00")
+	}
+	return strings.TrimPrefix(text, "\x00")
+}
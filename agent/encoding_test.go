@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"testing"
+)
+
+func TestLineDecoder(t *testing.T) {
+	tests := []struct {
+		name      string
+		collector Collector
+		lines     []string
+		want      []string
+	}{
+		{
+			name:      "gbk",
+			collector: Collector{Encoding: EncodingGBK},
+			lines:     []string{"\xd6\xd0\xce\xc4 log"},
+			want:      []string{"中文 log"},
+		},
+		{
+			name:      "gbk invalid replace",
+			collector: Collector{Encoding: EncodingGBK},
+			lines:     []string{"\xd6\xd0\xff"},
+			want:      []string{"中�"},
+		},
+		{
+			name:      "gbk invalid drop",
+			collector: Collector{Encoding: EncodingGBK, Invalid: InvalidDrop},
+			lines:     []string{"\xd6\xd0\xff"},
+			want:      []string{"中"},
+		},
+		{
+			name:      "gbk invalid pass",
+			collector: Collector{Encoding: EncodingGBK, Invalid: InvalidPass},
+			lines:     []string{"\xd6\xd0\xff"},
+			want:      []string{"\xd6\xd0\xff"},
+		},
+		{
+			name:      "utf-8 invalid drop",
+			collector: Collector{Encoding: EncodingUTF8, Invalid: InvalidDrop},
+			lines:     []string{"\xef\xbb\xbfok\xff"},
+			want:      []string{"ok"},
+		},
+		{
+			// "a\r\nb\n" 经过 tail 按照 '\n' 字节切分后的样子
+			name:      "utf-16le",
+			collector: Collector{Encoding: EncodingUTF16LE},
+			lines:     []string{"\xff\xfea\x00\r\x00", "\x00b\x00"},
+			want:      []string{"a", "b"},
+		},
+		{
+			name:      "utf-16be",
+			collector: Collector{Encoding: EncodingUTF16BE},
+			lines:     []string{"\x00a\x00", "\x00b\x00"},
+			want:      []string{"a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := newLineDecoder(tt.collector, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, line := range tt.lines {
+				if got := d.decode(line); got != tt.want[i] {
+					t.Errorf("decode(%q) = %q, want %q", line, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLineDecoderUnknownEncoding(t *testing.T) {
+	if _, err := newLineDecoder(Collector{Encoding: "latin-9"}, ""); err == nil {
+		t.Error("newLineDecoder() should fail with unknown encoding")
+	}
+}
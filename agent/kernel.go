@@ -1,11 +1,7 @@
 package agent
 
 import (
-	"io"
-	"log"
-	"os"
-	"path/filepath"
-
+	"github.com/y7ut/logagent/conf"
 	"github.com/y7ut/logagent/pkg/file"
 )
 
@@ -13,27 +9,22 @@ var (
 	app *App
 )
 
-func Init(dataPath string, logPath string, logFile string) {
-
-	err := file.PathExistOrCreate(dataPath)
-	if err != nil {
-		log.Fatalf("create runtime dir Error: %v", err)
+// Init 创建运行目录，设置日志并打开检查点
+func Init(dataPath string, logConf conf.Log) {
+	if err := initLogger(logConf); err != nil {
+		fatal("init logger error", "err", err)
 	}
 
-	err = file.PathExistOrCreate(logPath)
-	if err != nil {
-		log.Fatalf("create log dir Error: %v", err)
+	if err := file.PathExistOrCreate(dataPath); err != nil {
+		fatal("create runtime dir error", "path", dataPath, "err", err)
 	}
 
-	logFile = filepath.Join(logPath, logFile)
-	writerLog, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, os.ModeAppend|os.ModePerm)
+	checkpoints, err := openCheckpointStore(dataPath)
 	if err != nil {
-		log.Fatalf("create log File Error: %v", err)
+		fatal("open checkpoint store error", "err", err)
 	}
-	log.Default().SetFlags(log.LstdFlags)
-	log.Default().SetOutput(io.MultiWriter(writerLog, os.Stderr))
 
-	app = NewApp(dataPath)
+	app = NewApp(dataPath, checkpoints)
 }
 
 func Start() {
@@ -0,0 +1,160 @@
+package agent
+
+import (
+	"time"
+)
+
+// 收集器超过速率限制时的处理方式
+const (
+	OverLimitBlock  = "block"  // 等待令牌，读取进度落后但不丢日志
+	OverLimitSample = "sample" // 超限期间每 sample_rate 条只保留一条
+	OverLimitDrop   = "drop"   // 直接丢弃并计数
+)
+
+const defaultSampleRate = 10
+
+// tokenBucket 令牌桶，只在收集器自己的协程中使用，不需要加锁
+type tokenBucket struct {
+	rate   float64 // 每秒补充的令牌数
+	burst  float64 // 桶的容量
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket rate 不大于0时表示不限速，返回 nil
+func newTokenBucket(rate int, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	return &tokenBucket{rate: float64(rate), burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// ready 桶里的令牌是否够用，超过容量的请求只要桶是满的就放行
+func (b *tokenBucket) ready(n float64) bool {
+	if n > b.burst {
+		n = b.burst
+	}
+	return b.tokens >= n
+}
+
+// wait 还需要等待多久令牌才够用
+func (b *tokenBucket) wait(n float64) time.Duration {
+	if n > b.burst {
+		n = b.burst
+	}
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+// rateLimiter 按条数和字节数同时限速
+type rateLimiter struct {
+	lines      *tokenBucket
+	bytes      *tokenBucket
+	action     string
+	sampleRate int
+	sampled    int
+}
+
+// newRateLimiter 收集器没有配置限速时返回 nil
+func newRateLimiter(c Collector) *rateLimiter {
+	lines := newTokenBucket(c.RateLines, c.BurstLines)
+	bytes := newTokenBucket(c.RateBytes, c.BurstBytes)
+	if lines == nil && bytes == nil {
+		return nil
+	}
+	sampleRate := c.SampleRate
+	if sampleRate <= 0 {
+		sampleRate = defaultSampleRate
+	}
+	return &rateLimiter{lines: lines, bytes: bytes, action: c.OverLimit, sampleRate: sampleRate}
+}
+
+func (r *rateLimiter) refill(now time.Time) {
+	if r.lines != nil {
+		r.lines.refill(now)
+	}
+	if r.bytes != nil {
+		r.bytes.refill(now)
+	}
+}
+
+func (r *rateLimiter) ready(size int) bool {
+	return (r.lines == nil || r.lines.ready(1)) && (r.bytes == nil || r.bytes.ready(float64(size)))
+}
+
+// take 扣除令牌，允许扣成负数，之后的请求需要等待补齐
+func (r *rateLimiter) take(size int) {
+	if r.lines != nil {
+		r.lines.tokens--
+	}
+	if r.bytes != nil {
+		r.bytes.tokens -= float64(size)
+	}
+}
+
+func (r *rateLimiter) wait(size int) time.Duration {
+	var d time.Duration
+	if r.lines != nil {
+		d = r.lines.wait(1)
+	}
+	if r.bytes != nil {
+		if bd := r.bytes.wait(float64(size)); bd > d {
+			d = bd
+		}
+	}
+	return d
+}
+
+// allow 判断一条 size 字节的日志能否发送
+// block 模式下会一直等待到令牌足够，done 或 cancel 关闭时返回 false
+func (r *rateLimiter) allow(size int, done <-chan struct{}, cancel <-chan struct{}) bool {
+	r.refill(time.Now())
+	if r.ready(size) {
+		r.sampled = 0
+		r.take(size)
+		return true
+	}
+
+	switch r.action {
+	case OverLimitDrop:
+		return false
+	case OverLimitSample:
+		// 超限期间每 sampleRate 条保留一条
+		r.sampled++
+		if r.sampled >= r.sampleRate {
+			r.sampled = 0
+			r.take(size)
+			return true
+		}
+		return false
+	default:
+		for !r.ready(size) {
+			timer := time.NewTimer(r.wait(size))
+			select {
+			case <-timer.C:
+			case <-done:
+				timer.Stop()
+				return false
+			case <-cancel:
+				timer.Stop()
+				return false
+			}
+			r.refill(time.Now())
+		}
+		r.take(size)
+		return true
+	}
+}
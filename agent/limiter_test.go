@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterDrop(t *testing.T) {
+	limiter := newRateLimiter(Collector{RateLines: 5, OverLimit: OverLimitDrop})
+
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		if limiter.allow(10, nil, nil) {
+			allowed++
+		}
+	}
+	// 令牌桶初始是满的，突发上限默认等于速率
+	if allowed != 5 {
+		t.Errorf("allowed = %d, want %d", allowed, 5)
+	}
+}
+
+func TestRateLimiterSample(t *testing.T) {
+	limiter := newRateLimiter(Collector{RateBytes: 100, OverLimit: OverLimitSample, SampleRate: 4})
+
+	allowed := 0
+	for i := 0; i < 13; i++ {
+		if limiter.allow(50, nil, nil) {
+			allowed++
+		}
+	}
+	// 前两条用完突发，后面的11条每4条保留一条
+	if allowed != 4 {
+		t.Errorf("allowed = %d, want %d", allowed, 4)
+	}
+}
+
+func TestRateLimiterBlock(t *testing.T) {
+	limiter := newRateLimiter(Collector{RateLines: 100, BurstLines: 1})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if !limiter.allow(1, nil, nil) {
+			t.Fatal("block mode should never drop")
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Errorf("elapsed = %s, want at least 15ms", elapsed)
+	}
+
+	done := make(chan struct{})
+	close(done)
+	if limiter.allow(1, done, nil) {
+		t.Error("allow should give up when done is closed")
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	if limiter := newRateLimiter(Collector{Path: "/tmp/a.log"}); limiter != nil {
+		t.Errorf("newRateLimiter() = %v, want nil", limiter)
+	}
+}
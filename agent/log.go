@@ -16,6 +16,13 @@ type Log struct {
 	Content   string
 	Source    *LogAgent
 	CreatedAt time.Time
+	Offset    int64 // 写入后收集器的 offset 可以推进到这里，0 表示不推进
+	FileGen   int64 // Offset 属于 tail 第几次打开的文件
+	Part      int   // 超长日志切分后的第几段，从1开始，没有切分时为0
+	Parts     int   // 超长日志一共切成了几段
+	Truncated int   // 截断前的字节数，没有截断时为0
+	Backfill  bool  // 是否是从历史归档中回填的
+	Replay    bool  // 是否是通过 replay 命令重放的
 }
 
 // 从日志池中获取一个
@@ -24,9 +31,17 @@ func NewLog(content string, source *LogAgent, createdAt time.Time) *Log {
 	log.Content = content
 	log.Source = source
 	log.CreatedAt = createdAt
+	log.Offset, log.FileGen = 0, 0
+	log.Part, log.Parts, log.Truncated = 0, 0, 0
+	log.Backfill, log.Replay = false, false
 	return log
 }
 
+// Size 日志在内存预算中占用的字节数
+func (log *Log) Size() int64 {
+	return int64(len(log.Content))
+}
+
 // 放回日志池
 func (log *Log) Reset() {
 	logPool.Put(log)
@@ -1,10 +1,13 @@
 package agent
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hpcloud/tail"
@@ -13,10 +16,22 @@ import (
 type LogAgent struct {
 	Offset    int64         // 偏移值
 	done      chan struct{} // 结束信号
+	stopped   chan struct{} // tail 协程退出并记录完检查点后关闭
 	Tail      *tail.Tail    // 这个代理的tail
 	Collector Collector     // 所服务的收集任务
 	cycle     time.Duration // 周期
+	limiter   *rateLimiter  // 限速，没有配置时为 nil
+	decoder   *lineDecoder  // tail 协程的编码转换，没有配置时为 nil
+	stats     *agentStats   // 实时统计
+	stopOnce  sync.Once
+	cpMu      sync.Mutex    // 定期记录检查点和退出时的最后一次记录互斥
+	exited    bool          // tailer 已经停止，不能再记录检查点
+	reopened  chan struct{} // tail 重新打开文件(轮转或者截断)时通知
+	readTo    int64         // tail 协程收到的最后一行的结束位置
 
+	offsetMu  sync.Mutex
+	fileGen   int64 // tail 重新打开文件的次数，旧文件的位置不能再提交
+	delivered int64 // 已经写入 Kafka 的位置，检查点记录的是它
 }
 
 func NewAgent(c Collector) (*LogAgent, error) {
@@ -38,27 +53,58 @@ func NewAgent(c Collector) (*LogAgent, error) {
 		return nil, fmt.Errorf("logagent Type(%s) format error", c.Style)
 	}
 
-	offset, err := getLogFileOffset(app.runtimePath, fileName)
-
+	decoder, err := newLineDecoder(c, fileName)
 	if err != nil {
-		log.Printf("can not load offset num from %s", fileName)
-		offset = 0
+		return nil, err
+	}
+
+	var offset int64
+	if cp, ok := app.checkpoints.Get(fileName); ok {
+		var reason string
+		offset, reason = resumeOffset(cp, fileName)
+		if reason != "" {
+			slog.Warn("discard checkpoint", "file", fileName, "reason", reason)
+		}
+	} else {
+		slog.Info("no checkpoint, read from the beginning", "file", fileName)
 	}
-	log.Printf("load offset num from %s is %d", fileName, offset)
+	slog.Info("resume from offset", "file", fileName, "offset", offset)
+	l := &LogAgent{Collector: c, Offset: 0, cycle: LifeCycle, limiter: newRateLimiter(c), decoder: decoder, stats: newAgentStats(), done: make(chan struct{}), stopped: make(chan struct{}), reopened: make(chan struct{}), readTo: offset, delivered: offset}
+	l.stats.readTo.Store(offset)
 	config := tail.Config{
 		ReOpen:    true, // true则文件被删掉阻塞等待新建该文件，false则文件被删掉时程序结束
 		Follow:    true, // true则一直阻塞并监听指定文件，false则一次读完就结束程序
 		Location:  &tail.SeekInfo{Offset: offset, Whence: 1},
 		MustExist: false, // true则没有找到文件就报错并结束，false则没有找到文件就阻塞保持住
 		Poll:      true,  // 使用Linux的Poll函数，poll的作用是把当前的文件指针挂到等待队列
-		Logger:    tail.DiscardingLogger,
+		Logger:    log.New(reopenNotifier{l}, "", 0),
 	}
 
-	tailer, err := tail.TailFile(fileName, config)
+	l.Tail, err = tail.TailFile(fileName, config)
 	if err != nil {
 		return nil, err
 	}
-	return &LogAgent{Tail: tailer, Collector: c, Offset: 0, cycle: LifeCycle, done: make(chan struct{})}, nil
+	return l, nil
+}
+
+// tailReopenedLog tail 重新打开文件(轮转或者截断)后打印的日志，升级 tail 时要用 TestReopenNotifier 确认
+const tailReopenedLog = "Successfully reopened"
+
+// reopenNotifier 从 tail 的日志中找到重新打开文件的时机，通知收集器从新文件的开头计算位置
+// tail 在同一个协程中发送行和打印日志，通知和行的先后顺序是确定的
+type reopenNotifier struct {
+	l *LogAgent
+}
+
+func (n reopenNotifier) Write(p []byte) (int, error) {
+	// 不依赖 Logger 的前缀和 flags
+	if bytes.Contains(p, []byte(tailReopenedLog)) {
+		select {
+		case n.l.reopened <- struct{}{}:
+		case <-n.l.done:
+		}
+	}
+	return len(p), nil
 }
 
 func (l *LogAgent) tailLines() <-chan *tail.Line {
@@ -67,12 +113,32 @@ func (l *LogAgent) tailLines() <-chan *tail.Line {
 
 // Start 启动
 func (l *LogAgent) Start(ctx context.Context) {
+	// 每个收集器有自己的队列，由调度协程公平地送入 LogChannel
+	lane := logScheduler.join()
+
+	// 回填历史归档，和 tail 共用同一个队列
+	var backfilling sync.WaitGroup
+	if l.Collector.Backfill {
+		backfilling.Add(1)
+		go func() {
+			defer backfilling.Done()
+			l.backfill(ctx, lane)
+		}()
+	}
+
 	go func(ctx context.Context) {
 		defer func() {
+			// tail 可能正阻塞在重新打开文件的通知上，先放开它
+			l.Stop()
+			// 等回填协程退出后才能关闭队列
+			backfilling.Wait()
+			close(lane)
+			logScheduler.wake()
 			if err := l.exitTail(); err != nil {
-				log.Printf("failed to close tailer: %v", err)
+				slog.Warn("failed to close tailer", "path", l.Collector.Path, "err", err)
 			}
-			log.Printf("success to close %s tailer", l.Collector.Path)
+			slog.Info("tailer closed", "path", l.Collector.Path)
+			close(l.stopped)
 		}()
 		for {
 			select {
@@ -82,9 +148,45 @@ func (l *LogAgent) Start(ctx context.Context) {
 			case <-l.done:
 				// 退出
 				return
+			case <-l.reopened:
+				// 轮转或者截断后 tail 从新文件的开头读取
+				l.readTo = 0
+				l.stats.readTo.Store(0)
+				l.reopen()
 			case line := <-l.tailLines():
-				// 将所有的消息发送到一个统一的频道用于处理消息和限流
-				LogChannel <- NewLog(line.Text, l, line.Time)
+				// tail 去掉了行尾的换行符
+				l.readTo += int64(len(line.Text)) + 1
+				l.stats.readTo.Store(l.readTo)
+				l.stats.record(line.Text)
+				if l.limiter != nil && !l.limiter.allow(len(line.Text), l.done, ctx.Done()) {
+					rateLimitedLines.Add(l.Collector.Path, 1)
+					continue
+				}
+				logs := l.process(l.decoder, line.Text, line.Time)
+				for i, logmsg := range logs {
+					// 切分的多段中最后一段写入后，这一行才算发送完
+					if i == len(logs)-1 {
+						logmsg.Offset, logmsg.FileGen = l.readTo, l.fileGen
+					}
+					if !l.admit(ctx, logmsg) {
+						logmsg.Reset()
+						continue
+					}
+					// 将所有的消息发送到自己的队列，由调度协程统一送去处理
+					// 调度协程不再领取时队列会一直满着，退出信号不能被这里挡住
+					select {
+					case lane <- logmsg:
+						logScheduler.wake()
+					case <-l.done:
+						budget.release(logmsg.Size())
+						logmsg.Reset()
+						return
+					case <-ctx.Done():
+						budget.release(logmsg.Size())
+						logmsg.Reset()
+						return
+					}
+				}
 			}
 		}
 	}(ctx)
@@ -97,40 +199,147 @@ func (l *LogAgent) Start(ctx context.Context) {
 				// 退出当天的任务，然后重新启动
 				// 注意这里不需要去退出内部的tailer啥的，统一交给上面协程中的defer去处理
 				CloseChan <- l.Collector
-				time.Sleep(500 * time.Millisecond)
+				l.wait(ctx)
 				StartChan <- l.Collector
-				log.Printf("success refresh %s cycle", l.Collector.Path)
+				slog.Info("refresh cycle", "path", l.Collector.Path)
 				return
 			case <-l.done:
 				// 退出
-				log.Printf("stop refresh %s cycle", l.Collector.Path)
+				slog.Debug("stop refresh cycle", "path", l.Collector.Path)
 				return
 			case <-ctx.Done():
 				// 不触发倒计时:
-				log.Printf("stop refresh %s cycle", l.Collector.Path)
+				slog.Debug("stop refresh cycle", "path", l.Collector.Path)
 				return
 			}
 		}(ctx)
 	}
 }
 
+// checkpoint 记录当前读取到的位置，在下一次落盘时写入
+func (l *LogAgent) checkpoint() error {
+	l.cpMu.Lock()
+	defer l.cpMu.Unlock()
+	if l.exited {
+		return nil
+	}
+	return l.putCheckpoint()
+}
+
+// putCheckpoint 记录已经写入 Kafka 的位置，读出来但还在队列中的行不算
+func (l *LogAgent) putCheckpoint() error {
+	l.offsetMu.Lock()
+	offset := l.delivered
+	l.offsetMu.Unlock()
+	ino, fingerprint := fileIdentity(l.Tail.Filename)
+	app.checkpoints.Put(Checkpoint{Source: l.Tail.Filename, Offset: offset, Inode: ino, Fingerprint: fingerprint})
+	return nil
+}
+
+// finalCheckpoint 发送协程退出后记录最后写入的位置，这时收集器已经停止
+func (l *LogAgent) finalCheckpoint() error {
+	l.cpMu.Lock()
+	defer l.cpMu.Unlock()
+	return l.putCheckpoint()
+}
+
+// commit 一行写入 Kafka (或者死信) 后推进可以记录的位置
+func (l *LogAgent) commit(gen, offset int64) {
+	l.offsetMu.Lock()
+	defer l.offsetMu.Unlock()
+	if gen == l.fileGen && offset > l.delivered {
+		l.delivered = offset
+	}
+}
+
+// reopen tail 打开了新的文件，旧文件还没有写完的行不再推进位置
+func (l *LogAgent) reopen() {
+	l.offsetMu.Lock()
+	defer l.offsetMu.Unlock()
+	l.fileGen++
+	l.delivered = 0
+}
+
 // exitTail 取消这个任务中的监听tailer
 func (l *LogAgent) exitTail() error {
-	// 退出之前，记录 offset
-	offset, err := l.Tail.Tell()
-	if err != nil {
+	l.cpMu.Lock()
+	defer l.cpMu.Unlock()
+	l.exited = true
+
+	// 退出之前，记录 offset 并马上落盘
+	if err := l.putCheckpoint(); err != nil {
 		return err
 	}
-	if err := l.Tail.Stop(); err != nil {
+	if err := l.stopTail(); err != nil {
 		return err
 	}
+	return app.checkpoints.Flush()
+}
 
-	putLogFileOffset(app.runtimePath, l.Tail.Filename, offset)
-	return nil
+// stopTail 停止 tail，tail 发送行时不会检查退出信号，停止的同时要把它正在发送的行取走
+// 这些行没有写入 Kafka，下次从检查点重新读取
+func (l *LogAgent) stopTail() error {
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- l.Tail.Stop()
+	}()
+	for {
+		select {
+		case err := <-stopped:
+			return err
+		case <-l.Tail.Lines:
+		}
+	}
+}
+
+// admit 为一条日志申请内存预算，返回 false 表示这条日志不再发送
+func (l *LogAgent) admit(ctx context.Context, logmsg *Log) bool {
+	size := logmsg.Size()
+	if budget.tryAcquire(size) {
+		return true
+	}
+
+	switch l.Collector.Overflow {
+	case OverflowDropNewest:
+		droppedLines.Add(l.Collector.Path, 1)
+		return false
+	case OverflowDropOldest:
+		// 先放进来，再让发送协程淘汰这个收集器最早的一条
+		budget.forceAcquire(size)
+		select {
+		case evictChan <- l.Collector.Path:
+			return true
+		default:
+			// 淘汰请求已经堆满了，丢掉新的这条，不再继续超出预算
+			budget.release(size)
+			droppedLines.Add(l.Collector.Path, 1)
+			return false
+		}
+	default:
+		// 暂停读取，tail 也会随之阻塞，offset 停留在还没有发送的位置
+		slog.Warn("memory budget exhausted, pause tailing", "path", l.Collector.Path)
+		pausedAgents.Add(1)
+		defer pausedAgents.Add(-1)
+		if !budget.acquire(size, l.done, ctx.Done()) {
+			return false
+		}
+		slog.Info("memory budget released, resume tailing", "path", l.Collector.Path)
+		return true
+	}
+}
+
+// wait 等待 tail 协程退出，这时检查点已经落盘，同一个文件可以交给新的收集器了
+func (l *LogAgent) wait(ctx context.Context) {
+	select {
+	case <-l.stopped:
+	case <-ctx.Done():
+	}
 }
 
 // Stop 停止任务
 func (l *LogAgent) Stop() error {
-	l.done <- struct{}{}
+	l.stopOnce.Do(func() {
+		close(l.done)
+	})
 	return nil
 }
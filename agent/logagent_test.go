@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 调度协程没有在领取时队列会满，收集器还要能正常退出
+func TestStopWithFullLane(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openCheckpointStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	app = NewApp(dir, store)
+
+	path := filepath.Join(dir, "app.log")
+	var content strings.Builder
+	for i := 0; i < 2*laneSize; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	if err := os.WriteFile(path, []byte(content.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewAgent(Collector{Style: "File", Path: path, Topic: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Start(context.Background())
+
+	// 等到队列满了，收集器阻塞在发送上
+	lanes := logScheduler.snapshot()
+	lane := lanes[len(lanes)-1]
+	for deadline := time.Now().Add(5 * time.Second); len(lane) < laneSize; {
+		if time.Now().After(deadline) {
+			t.Fatalf("lane has %d lines, want %d", len(lane), laneSize)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	l.Stop()
+	select {
+	case <-l.stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("collector did not stop with a full lane")
+	}
+
+	// 把队列中的日志领走，避免影响其他测试
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	defer stopScheduler()
+	go logScheduler.run(schedulerCtx)
+	for len(logScheduler.snapshot()) > 0 {
+		select {
+		case logmsg := <-LogChannel:
+			budget.release(logmsg.Size())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// 依赖 tail v1.0.0 重新打开文件时打印的日志，升级 tail 后这里失败说明 tailReopenedLog 需要跟着改
+func TestReopenNotifier(t *testing.T) {
+	tests := []struct {
+		name   string
+		reopen func(t *testing.T, path string)
+	}{
+		{"truncate", func(t *testing.T, path string) {
+			if err := os.WriteFile(path, []byte("b\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"rotate", func(t *testing.T, path string) {
+			if err := os.Rename(path, path+".1"); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte("b\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := openCheckpointStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			app = NewApp(dir, store)
+
+			path := filepath.Join(dir, "app.log")
+			if err := os.WriteFile(path, []byte("aaaa\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			l, err := NewAgent(Collector{Style: "File", Path: path, Topic: "app"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				l.Stop()
+				l.stopTail()
+			}()
+
+			next := func() string {
+				select {
+				case line := <-l.Tail.Lines:
+					return line.Text
+				case <-l.reopened:
+					return "reopened"
+				case <-time.After(5 * time.Second):
+					return "timeout"
+				}
+			}
+			if got := next(); got != "aaaa" {
+				t.Fatalf("first event = %q, want aaaa", got)
+			}
+			tt.reopen(t, path)
+			// 通知要在新文件的第一行之前
+			if got := next(); got != "reopened" {
+				t.Fatalf("event after %s = %q, want reopened", tt.name, got)
+			}
+			if got := next(); got != "b" {
+				t.Errorf("event after reopened = %q, want b", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/y7ut/logagent/conf"
+	"github.com/y7ut/logagent/pkg/file"
+)
+
+// 日志的格式
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// 日志轮转的默认值
+const (
+	defaultLogMaxSize    = 100 << 20
+	defaultLogMaxAge     = 7 * 24 * time.Hour
+	defaultLogMaxBackups = 7
+	defaultLogName       = "bifrost.log"
+)
+
+// ParseLogLevel 解析 debug、info、warn、error，为空时是 info
+func ParseLogLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if level == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return l, fmt.Errorf("log level(%s) must be one of debug, info, warn, error", level)
+	}
+	return l, nil
+}
+
+// LogFile 配置中的日志文件路径
+func LogFile(c conf.Log) string {
+	name := c.Name
+	if name == "" {
+		name = defaultLogName
+	}
+	return filepath.Join(c.Path, name)
+}
+
+// initLogger 把 slog 的默认 logger 设置为同时写入轮转的日志文件和标准错误
+// 标准库的 log 也会转到 slog 中
+func initLogger(c conf.Log) error {
+	level, err := ParseLogLevel(c.Level)
+	if err != nil {
+		return err
+	}
+	if err := file.PathExistOrCreate(c.Path); err != nil {
+		return err
+	}
+
+	maxSize, maxAge, maxBackups := c.MaxSize, c.MaxAge, c.MaxBackups
+	if maxSize == 0 {
+		maxSize = defaultLogMaxSize
+	}
+	if maxAge == 0 {
+		maxAge = defaultLogMaxAge
+	}
+	if maxBackups == 0 {
+		maxBackups = defaultLogMaxBackups
+	}
+	writer, err := file.NewRotateWriter(LogFile(c), maxSize, c.RotateEvery, maxAge, maxBackups)
+	if err != nil {
+		return err
+	}
+
+	out := io.MultiWriter(writer, os.Stderr)
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(c.Format) {
+	case "", LogFormatText:
+		handler = slog.NewTextHandler(out, options)
+	case LogFormatJSON:
+		handler = slog.NewJSONHandler(out, options)
+	default:
+		writer.Close()
+		return fmt.Errorf("log format(%s) must be text or json", c.Format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// fatal 记录错误后退出
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
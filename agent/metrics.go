@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"expvar"
+	"log/slog"
+	"net/http"
+)
+
+// 运行指标，通过 expvar 在 [metrics] 配置的地址上以 /debug/vars 暴露
+var (
+	metrics            = expvar.NewMap("bifrost")
+	pausedAgents       = new(expvar.Int)        // 因为内存预算耗尽而暂停读取的收集器数量
+	droppedLines       = new(expvar.Map).Init() // 按收集器路径统计丢弃的日志条数
+	rateLimitedLines   = new(expvar.Map).Init() // 按收集器路径统计因为限速丢弃的日志条数
+	retriedMessages    = new(expvar.Int)        // 重新写入 Kafka 的消息条数
+	deadLetterMessages = new(expvar.Int)        // 进入死信的消息条数
+	connectionErrors   = new(expvar.Int)        // 连不上 Kafka 而重试的次数
+	backfillLines      = new(expvar.Map).Init() // 按收集器路径统计从历史归档回填的日志条数
+	collectorErrors    = new(expvar.Map).Init() // 按收集器路径统计进入死信的消息条数
+)
+
+func init() {
+	metrics.Set("memory_used", expvar.Func(func() any { return budget.Used() }))
+	metrics.Set("memory_limit", expvar.Func(func() any { return budget.Limit() }))
+	metrics.Set("memory_exhausted", expvar.Func(func() any { return budget.Exhausted() }))
+	metrics.Set("paused_agents", pausedAgents)
+	metrics.Set("dropped_lines", droppedLines)
+	metrics.Set("rate_limited_lines", rateLimitedLines)
+	metrics.Set("retried_messages", retriedMessages)
+	metrics.Set("dead_letter_messages", deadLetterMessages)
+	metrics.Set("kafka_connection_errors", connectionErrors)
+	metrics.Set("kafka_unreachable_seconds", expvar.Func(func() any { return int64(kafkaUnreachableFor().Seconds()) }))
+	metrics.Set("backfill_lines", backfillLines)
+	metrics.Set("collector_errors", collectorErrors)
+	metrics.Set("collectors", expvar.Func(collectorStatuses))
+	http.HandleFunc("/debug/bifrost/recent", serveRecentLines)
+}
+
+// mapValue 读取 expvar.Map 中的一个计数，没有时为0
+func mapValue(m *expvar.Map, key string) int64 {
+	if v, ok := m.Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// serveMetrics 启动指标服务
+func serveMetrics(address string) {
+	slog.Info("metrics listen", "address", address)
+	if err := http.ListenAndServe(address, nil); err != nil {
+		slog.Error("metrics server error", "err", err)
+	}
+}
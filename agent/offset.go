@@ -1,34 +1,45 @@
 package agent
 
-import (
-	"encoding/base64"
-	"os"
-	"path/filepath"
-	"strconv"
-)
-
-// 设置文件的offset
-func putLogFileOffset(dataPath string, filename string, offset int64) error {
-
-	content := []byte(strconv.FormatInt(offset, 10))
-	offilename := filepath.Join(dataPath, base64.StdEncoding.EncodeToString([]byte(filename))+".offset")
-	err := os.WriteFile(offilename, content, 0644)
-	return err
+// ListOffsets 列出运行目录中所有的检查点，不需要停止 bifrost
+func ListOffsets(dataPath string) ([]Checkpoint, error) {
+	return loadCheckpoints(dataPath)
 }
 
-// 读取
-func getLogFileOffset(dataPath string, filename string) (int64, error) {
-	offilename := filepath.Join(dataPath, base64.StdEncoding.EncodeToString([]byte(filename))+".offset")
-	var result int64
-	offset, err := os.ReadFile(offilename)
+// SetOffset 修改一个文件的 offset，收集器下次启动时从这里开始读取
+func SetOffset(dataPath string, path string, offset int64) error {
+	store, err := openCheckpointStore(dataPath)
 	if err != nil {
-		return result, err
+		return err
 	}
+	ino, fingerprint := fileIdentity(path)
+	store.Put(Checkpoint{Source: path, Offset: offset, Inode: ino, Fingerprint: fingerprint})
+	return store.Close()
+}
 
-	result, err = strconv.ParseInt(string(offset), 10, 64)
+// ResetOffset 删除一个文件的 offset 记录，收集器下次启动时从头开始读取
+func ResetOffset(dataPath string, path string) error {
+	store, err := openCheckpointStore(dataPath)
 	if err != nil {
-		return result, err
+		return err
+	}
+	if err := store.Delete(path); err != nil {
+		store.Close()
+		return err
 	}
+	return store.Close()
+}
 
-	return result, nil
+// ResetOffsets 批量删除 offset 记录
+func ResetOffsets(dataPath string, paths []string) error {
+	store, err := openCheckpointStore(dataPath)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := store.Delete(path); err != nil {
+			store.Close()
+			return err
+		}
+	}
+	return store.Close()
 }
@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"time"
+	"unicode/utf8"
+)
+
+// 超长日志的处理方式
+const (
+	LineModeTruncate = "truncate" // 截断并在末尾加上标记
+	LineModeSplit    = "split"    // 切成多条发送
+)
+
+const truncatedMarker = "...[truncated]"
+
+// linePiece 一行日志切分后的一段
+type linePiece struct {
+	text      string
+	part      int // 第几段，从1开始，没有切分时为0
+	parts     int // 一共几段
+	truncated int // 截断前的字节数，没有截断时为0
+}
+
+// process 处理阶段，把 tail 读到的一行转化成要发送的日志
+// decoder 带有状态，不能在协程之间共用，tail 和回填各自使用自己的 decoder
+func (l *LogAgent) process(decoder *lineDecoder, text string, createdAt time.Time) []*Log {
+	if decoder != nil {
+		text = decoder.decode(text)
+	}
+	pieces := cutLine(text, l.Collector.MaxLineBytes, l.Collector.LineMode)
+	logs := make([]*Log, 0, len(pieces))
+	for _, piece := range pieces {
+		logmsg := NewLog(piece.text, l, createdAt)
+		logmsg.Part, logmsg.Parts, logmsg.Truncated = piece.part, piece.parts, piece.truncated
+		logs = append(logs, logmsg)
+	}
+	return logs
+}
+
+// cutLine 按照最大字节数处理一行日志，切分的位置不会落在一个 UTF-8 字符的中间
+func cutLine(text string, max int, mode string) []linePiece {
+	if max <= 0 || len(text) <= max {
+		return []linePiece{{text: text}}
+	}
+
+	if mode != LineModeSplit {
+		// 上限连标记都放不下的时候就只截断
+		if max <= len(truncatedMarker) {
+			return []linePiece{{text: cutUTF8(text, max), truncated: len(text)}}
+		}
+		return []linePiece{{text: cutUTF8(text, max-len(truncatedMarker)) + truncatedMarker, truncated: len(text)}}
+	}
+
+	pieces := make([]linePiece, 0, len(text)/max+1)
+	for rest := text; len(rest) > 0; {
+		piece := cutUTF8(rest, max)
+		if piece == "" {
+			// 上限比一个字符还小，至少要前进一个字符
+			_, size := utf8.DecodeRuneInString(rest)
+			piece = rest[:size]
+		}
+		pieces = append(pieces, linePiece{text: piece})
+		rest = rest[len(piece):]
+	}
+	for i := range pieces {
+		pieces[i].part, pieces[i].parts = i+1, len(pieces)
+	}
+	return pieces
+}
+
+// cutUTF8 取不超过 n 个字节的前缀，并退回到字符的边界
+func cutUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
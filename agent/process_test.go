@@ -0,0 +1,82 @@
+package agent
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCutLine(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		max  int
+		mode string
+		want []linePiece
+	}{
+		{
+			name: "unlimited",
+			text: "hello world",
+			max:  0,
+			want: []linePiece{{text: "hello world"}},
+		},
+		{
+			name: "short line",
+			text: "hello",
+			max:  10,
+			mode: LineModeSplit,
+			want: []linePiece{{text: "hello"}},
+		},
+		{
+			name: "truncate",
+			text: strings.Repeat("a", 30),
+			max:  20,
+			mode: LineModeTruncate,
+			want: []linePiece{{text: "aaaaaa" + truncatedMarker, truncated: 30}},
+		},
+		{
+			name: "truncate without marker",
+			text: strings.Repeat("a", 30),
+			max:  5,
+			want: []linePiece{{text: "aaaaa", truncated: 30}},
+		},
+		{
+			name: "split",
+			text: "abcdefg",
+			max:  3,
+			mode: LineModeSplit,
+			want: []linePiece{
+				{text: "abc", part: 1, parts: 3},
+				{text: "def", part: 2, parts: 3},
+				{text: "g", part: 3, parts: 3},
+			},
+		},
+		{
+			name: "split utf8",
+			text: "日志收集",
+			max:  7,
+			mode: LineModeSplit,
+			want: []linePiece{
+				{text: "日志", part: 1, parts: 2},
+				{text: "收集", part: 2, parts: 2},
+			},
+		},
+		{
+			name: "split smaller than rune",
+			text: "日志",
+			max:  1,
+			mode: LineModeSplit,
+			want: []linePiece{
+				{text: "日", part: 1, parts: 2},
+				{text: "志", part: 2, parts: 2},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cutLine(tt.text, tt.max, tt.mode); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cutLine() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
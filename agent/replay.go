@@ -0,0 +1,193 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/y7ut/logagent/conf"
+)
+
+// 重放范围的单位
+const (
+	ReplayByOffset = "offset" // 字节偏移，左闭右开
+	ReplayByLine   = "line"   // 行号，从1开始，两端都包含
+	ReplayByTime   = "time"   // 每行开头的时间，两端都包含
+)
+
+// ReplayRange 重放的范围，End 为0或者 Until 为零值时表示一直到文件末尾
+type ReplayRange struct {
+	By         string
+	Start      int64
+	End        int64
+	Since      time.Time
+	Until      time.Time
+	TimeLayout string
+}
+
+// ReplayResult 重放的结果
+type ReplayResult struct {
+	Lines       int   // 读取并交给发送协程的行数
+	Undelivered int64 // 没有写入目标 Topic 的消息条数，它们在死信中
+}
+
+// Replay 把文件中的一段重新发送到 Kafka
+// 和 run 使用同样的处理阶段、限速和发送流程，但不会读写守护进程的 offset
+func Replay(ctx context.Context, c Collector, fileName string, r ReplayRange) (result ReplayResult, err error) {
+	switch r.By {
+	case ReplayByOffset, ReplayByLine:
+	case ReplayByTime:
+		if r.TimeLayout == "" {
+			return result, fmt.Errorf("replay by time needs a time layout")
+		}
+	default:
+		return result, fmt.Errorf("replay unit(%s) format error", r.By)
+	}
+
+	decoder, err := newLineDecoder(c, fileName)
+	if err != nil {
+		return result, err
+	}
+	reader, closer, err := openArchive(fileName)
+	if err != nil {
+		return result, err
+	}
+	defer closer()
+
+	budget.setLimit(conf.APPConfig.Kafka.MemoryLimit)
+
+	// 发送协程在读取结束后退出，退出前会把缓冲中的消息写完
+	// Kafka 不可用时最多等待 senderDrainTimeout，剩下的消息写入死信文件
+	senderCtx, cancel := context.WithCancel(context.Background())
+	senderDone := make(chan struct{})
+	go func() {
+		KafkaSender(senderCtx)
+		close(senderDone)
+	}()
+	dead := deadLetterMessages.Value()
+	defer func() {
+		cancel()
+		<-senderDone
+		result.Undelivered = deadLetterMessages.Value() - dead
+	}()
+
+	result.Lines, err = newReplayAgent(c, decoder).replay(ctx, reader, r, LogChannel)
+	return result, err
+}
+
+// newReplayAgent 重放使用的收集器，只用来处理日志，不会启动 tail
+// 重放是为了补发，超过限速时只等待，不采样也不丢弃
+func newReplayAgent(c Collector, decoder *lineDecoder) *LogAgent {
+	limit := c
+	limit.OverLimit = OverLimitBlock
+	return &LogAgent{Collector: c, limiter: newRateLimiter(limit), decoder: decoder, done: make(chan struct{})}
+}
+
+// replay 读取范围内的每一行，处理后送到 out，返回读取的行数
+func (l *LogAgent) replay(ctx context.Context, reader *bufio.Reader, r ReplayRange, out chan<- *Log) (int, error) {
+	var count int
+	err := r.scan(reader, func(text string, createdAt time.Time) bool {
+		if l.limiter != nil && !l.limiter.allow(len(text), l.done, ctx.Done()) {
+			return false
+		}
+		for _, logmsg := range l.process(l.decoder, text, createdAt) {
+			logmsg.Replay = true
+			if !l.admit(ctx, logmsg) {
+				logmsg.Reset()
+				continue
+			}
+			select {
+			case out <- logmsg:
+			case <-ctx.Done():
+				return false
+			}
+		}
+		count++
+		return true
+	})
+	if err == nil {
+		err = ctx.Err()
+	}
+	return count, err
+}
+
+// scan 读取范围内的每一行，emit 返回 false 时停止
+func (r ReplayRange) scan(reader *bufio.Reader, emit func(text string, createdAt time.Time) bool) error {
+	var pos, lineNo int64
+	var lineTime time.Time
+
+	if r.By == ReplayByOffset && r.Start > 0 {
+		n, err := reader.Discard(int(r.Start))
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		pos = int64(n)
+	}
+
+	for {
+		text, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if text == "" {
+			return nil
+		}
+		start := pos
+		pos += int64(len(text))
+		lineNo++
+		text = strings.TrimRight(text, "\n")
+		createdAt := time.Now()
+
+		switch r.By {
+		case ReplayByOffset:
+			if r.End > 0 && start >= r.End {
+				return nil
+			}
+		case ReplayByLine:
+			if lineNo < r.Start {
+				continue
+			}
+			if r.End > 0 && lineNo > r.End {
+				return nil
+			}
+		case ReplayByTime:
+			// 没有时间的行(比如堆栈)跟随上一行的时间
+			if t, ok := parseLineTime(text, r.TimeLayout); ok {
+				lineTime = t
+			}
+			if lineTime.IsZero() || lineTime.Before(r.Since) {
+				continue
+			}
+			if !r.Until.IsZero() && lineTime.After(r.Until) {
+				return nil
+			}
+			createdAt = lineTime
+		}
+
+		if !emit(text, createdAt) {
+			return nil
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// parseLineTime 按照 layout 解析一行开头的时间，允许时间被 [] 包起来
+func parseLineTime(text string, layout string) (time.Time, bool) {
+	text = strings.TrimPrefix(text, "[")
+	if len(text) < len(layout) {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(layout, text[:len(layout)], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
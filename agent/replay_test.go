@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplayRangeScan(t *testing.T) {
+	content := "2023-06-01 10:00:00 a\n" +
+		"2023-06-01 10:00:01 b\n" +
+		"  at stack\n" +
+		"2023-06-01 10:00:02 c\n" +
+		"2023-06-01 10:00:03 d"
+	layout := "2006-01-02 15:04:05"
+	at := func(s string) time.Time {
+		t, _ := time.ParseInLocation(layout, s, time.Local)
+		return t
+	}
+
+	tests := []struct {
+		name string
+		r    ReplayRange
+		want []string
+	}{
+		{
+			name: "offset",
+			r:    ReplayRange{By: ReplayByOffset, Start: 22, End: 55},
+			want: []string{"2023-06-01 10:00:01 b", "  at stack"},
+		},
+		{
+			name: "offset to end",
+			r:    ReplayRange{By: ReplayByOffset, Start: 55},
+			want: []string{"2023-06-01 10:00:02 c", "2023-06-01 10:00:03 d"},
+		},
+		{
+			name: "line",
+			r:    ReplayRange{By: ReplayByLine, Start: 2, End: 3},
+			want: []string{"2023-06-01 10:00:01 b", "  at stack"},
+		},
+		{
+			name: "time",
+			r:    ReplayRange{By: ReplayByTime, Since: at("2023-06-01 10:00:01"), Until: at("2023-06-01 10:00:02"), TimeLayout: layout},
+			want: []string{"2023-06-01 10:00:01 b", "  at stack", "2023-06-01 10:00:02 c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]string, 0)
+			err := tt.r.scan(bufio.NewReader(strings.NewReader(content)), func(text string, createdAt time.Time) bool {
+				got = append(got, text)
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scan() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplayRateLimit(t *testing.T) {
+	const lines = 6
+	content := strings.Repeat("line\n", lines)
+	// 收集器配置了丢弃，重放时也只等待
+	c := Collector{Style: "File", Path: "/var/log/app.log", Topic: "app", RateLines: 20, BurstLines: 1, OverLimit: OverLimitDrop}
+	l := newReplayAgent(c, nil)
+
+	out := make(chan *Log, lines)
+	start := time.Now()
+	count, err := l.replay(context.Background(), bufio.NewReader(strings.NewReader(content)), ReplayRange{By: ReplayByOffset}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(out)
+	for logmsg := range out {
+		budget.release(logmsg.Size())
+	}
+	if count != lines {
+		t.Errorf("replayed %d lines, want %d", count, lines)
+	}
+	// 第一条使用桶里的令牌，之后每条等待 50ms
+	if elapsed, want := time.Since(start), (lines-1)*50*time.Millisecond; elapsed < want*8/10 {
+		t.Errorf("replayed %d lines in %s, want at least %s", lines, elapsed, want)
+	}
+}
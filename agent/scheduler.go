@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 每个收集器自己的队列长度
+const laneSize = 16
+
+var logScheduler = newScheduler()
+
+// scheduler 在各个收集器的队列之间轮转，每轮每个收集器最多送一条日志进入 LogChannel
+// 这样一个刷屏的收集器只会塞满自己的队列，不会饿死共享同一个发送协程的其他收集器
+type scheduler struct {
+	mu     sync.Mutex
+	lanes  []chan *Log
+	notify chan struct{}
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{lanes: make([]chan *Log, 0), notify: make(chan struct{}, 1)}
+}
+
+// join 为收集器创建一个队列，收集器退出时关闭它，剩余的日志发送完后会被移除
+func (s *scheduler) join() chan *Log {
+	lane := make(chan *Log, laneSize)
+	s.mu.Lock()
+	s.lanes = append(s.lanes, lane)
+	s.mu.Unlock()
+	return lane
+}
+
+// wake 通知调度协程有新的日志
+func (s *scheduler) wake() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *scheduler) remove(lane chan *Log) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, v := range s.lanes {
+		if v == lane {
+			s.lanes = append(s.lanes[:i], s.lanes[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *scheduler) snapshot() []chan *Log {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lanes := make([]chan *Log, len(s.lanes))
+	copy(lanes, s.lanes)
+	return lanes
+}
+
+// run 调度协程
+func (s *scheduler) run(ctx context.Context) {
+	// 空闲时也定期报告进度，给 systemd 的看门狗使用
+	schedulerProgress.beat()
+	beat := time.NewTicker(progressInterval)
+	defer beat.Stop()
+
+	for {
+		select {
+		case <-beat.C:
+			schedulerProgress.beat()
+		default:
+		}
+
+		moved := false
+		for _, lane := range s.snapshot() {
+			select {
+			case logmsg, ok := <-lane:
+				if !ok {
+					s.remove(lane)
+					continue
+				}
+				select {
+				case LogChannel <- logmsg:
+				case <-ctx.Done():
+					return
+				}
+				moved = true
+			default:
+			}
+		}
+
+		if !moved {
+			select {
+			case <-s.notify:
+			case <-beat.C:
+				schedulerProgress.beat()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/y7ut/logagent/conf"
+)
+
+// 每个收集器保留的最近日志条数
+const recentLinesSize = 50
+
+// agentStats 一个收集器的实时统计，给 top 命令使用
+type agentStats struct {
+	lines    atomic.Int64
+	bytes    atomic.Int64
+	lastLine atomic.Int64 // 最后一行的时间，UnixNano
+	readTo   atomic.Int64 // tail 协程读到的位置，由 tail 协程发布，其他协程不能直接调用 tail
+
+	mu     sync.Mutex
+	recent []string // 环形缓冲
+	next   int
+}
+
+func newAgentStats() *agentStats {
+	return &agentStats{recent: make([]string, 0, recentLinesSize)}
+}
+
+// record 记录读到的一行
+func (s *agentStats) record(text string) {
+	s.lines.Add(1)
+	s.bytes.Add(int64(len(text)))
+	s.lastLine.Store(time.Now().UnixNano())
+
+	s.mu.Lock()
+	if len(s.recent) < recentLinesSize {
+		s.recent = append(s.recent, text)
+	} else {
+		s.recent[s.next] = text
+	}
+	s.next = (s.next + 1) % recentLinesSize
+	s.mu.Unlock()
+}
+
+// recentLines 按照从旧到新的顺序返回最近的日志
+func (s *agentStats) recentLines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.recent) < recentLinesSize {
+		return append([]string{}, s.recent...)
+	}
+	return append(append([]string{}, s.recent[s.next:]...), s.recent[:s.next]...)
+}
+
+// CollectorStatus 一个收集器的状态，通过 /debug/vars 中的 bifrost.collectors 暴露
+type CollectorStatus struct {
+	Path     string    `json:"path"`
+	File     string    `json:"file"`  // 当前读取的文件
+	Topic    string    `json:"topic"` // 发送到的 Topic
+	Lines    int64     `json:"lines"` // 启动以来读取的行数
+	Bytes    int64     `json:"bytes"` // 启动以来读取的字节数
+	Offset   int64     `json:"offset"`
+	Size     int64     `json:"size"`
+	Lag      int64     `json:"lag"`       // 还没有读取的字节数
+	Errors   int64     `json:"errors"`    // 发送失败进入死信的条数
+	Dropped  int64     `json:"dropped"`   // 因为内存预算或者限速丢弃的条数
+	LastLine time.Time `json:"last_line"` // 最后一行的时间，还没有读到时为零值
+}
+
+// status 收集器当前的状态
+func (l *LogAgent) status() CollectorStatus {
+	st := CollectorStatus{
+		Path:    l.Collector.Path,
+		File:    l.Tail.Filename,
+		Topic:   l.Collector.Topic,
+		Lines:   l.stats.lines.Load(),
+		Bytes:   l.stats.bytes.Load(),
+		Errors:  mapValue(collectorErrors, l.Collector.Path),
+		Dropped: mapValue(droppedLines, l.Collector.Path) + mapValue(rateLimitedLines, l.Collector.Path),
+	}
+	if last := l.stats.lastLine.Load(); last > 0 {
+		st.LastLine = time.Unix(0, last)
+	}
+
+	st.Offset = l.stats.readTo.Load()
+	if info, err := os.Stat(l.Tail.Filename); err == nil {
+		st.Size = info.Size()
+		if st.Size > st.Offset {
+			st.Lag = st.Size - st.Offset
+		}
+	}
+	return st
+}
+
+// collectorStatuses 所有运行中的收集器的状态，按照路径索引
+func collectorStatuses() any {
+	result := make(map[string]CollectorStatus)
+	if app == nil {
+		return result
+	}
+	for path, logagent := range app.allAgent() {
+		result[path] = logagent.status()
+	}
+	return result
+}
+
+// serveRecentLines 返回一个收集器最近读到的日志，/debug/bifrost/recent?path=
+// 日志中可能有敏感信息，需要在 [metrics] 中设置 recent=true 才提供
+func serveRecentLines(w http.ResponseWriter, r *http.Request) {
+	if !conf.APPConfig.Metrics.Recent {
+		http.Error(w, "recent lines are disabled, set recent=true in [metrics] of bifrost", http.StatusForbidden)
+		return
+	}
+	if app == nil {
+		http.Error(w, "bifrost is not running", http.StatusServiceUnavailable)
+		return
+	}
+	logagent, ok := app.getAgent(r.URL.Query().Get("path"))
+	if !ok {
+		http.Error(w, "collector not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(logagent.stats.recentLines())
+}
@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/y7ut/logagent/conf"
+)
+
+func TestServeRecentLines(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openCheckpointStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	app = NewApp(dir, store)
+	l := &LogAgent{Collector: Collector{Path: "/var/log/a.log"}, stats: newAgentStats()}
+	l.stats.record("password=123")
+	app.setAgent(l.Collector.Path, l)
+	defer func() { conf.APPConfig.Metrics.Recent = false }()
+
+	tests := []struct {
+		name   string
+		recent bool
+		path   string
+		status int
+	}{
+		{"disabled by default", false, "/var/log/a.log", http.StatusForbidden},
+		{"enabled", true, "/var/log/a.log", http.StatusOK},
+		{"unknown collector", true, "/var/log/b.log", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf.APPConfig.Metrics.Recent = tt.recent
+			w := httptest.NewRecorder()
+			serveRecentLines(w, httptest.NewRequest(http.MethodGet, "/debug/bifrost/recent?path="+url.QueryEscape(tt.path), nil))
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d", w.Code, tt.status)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var lines []string
+			if err := json.NewDecoder(w.Body).Decode(&lines); err != nil {
+				t.Fatal(err)
+			}
+			if len(lines) != 1 || lines[0] != "password=123" {
+				t.Errorf("recent lines %q", lines)
+			}
+		})
+	}
+}
+
+// status 在指标服务的协程中调用，和 tail 协程同时运行，需要在 -race 下运行
+func TestStatusOffset(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openCheckpointStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	app = NewApp(dir, store)
+
+	path := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(path, []byte("a\nbb\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewAgent(Collector{Style: "File", Path: path, Topic: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	defer stopScheduler()
+	go logScheduler.run(schedulerCtx)
+	l.Start(ctx)
+	defer func() {
+		cancel()
+		for len(logScheduler.snapshot()) > 0 {
+			select {
+			case <-LogChannel:
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		<-l.stopped
+	}()
+
+	// waitOffset 一边领取日志一边查看状态，直到读完整个文件
+	waitOffset := func(want int64) {
+		deadline := time.After(5 * time.Second)
+		for {
+			if st := l.status(); st.Offset == want {
+				if st.Lag != 0 {
+					t.Errorf("lag = %d, want 0", st.Lag)
+				}
+				return
+			}
+			select {
+			case logmsg := <-LogChannel:
+				budget.release(logmsg.Size())
+			case <-time.After(10 * time.Millisecond):
+			case <-deadline:
+				t.Fatalf("offset = %d, want %d", l.status().Offset, want)
+			}
+		}
+	}
+	waitOffset(5)
+
+	// 截断后从新文件的开头计算
+	if err := os.WriteFile(path, []byte("ccc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitOffset(4)
+}
@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+)
+
+// 作为 systemd 的 Type=notify 服务运行时，通过 sd_notify 报告状态
+// 没有 NOTIFY_SOCKET 环境变量时这些都不会做任何事情
+
+// notifyReady 第一批收集器启动之后通知 systemd 启动完成
+func notifyReady(count int) {
+	state := fmt.Sprintf("%s\nSTATUS=watching %d collectors", daemon.SdNotifyReady, count)
+	if _, err := daemon.SdNotify(false, state); err != nil {
+		slog.Warn("failed to notify systemd", "err", err)
+	}
+}
+
+// notifyStopping 开始退出时通知 systemd，退出的时间受 TimeoutStopSec 限制
+func notifyStopping() {
+	if _, err := daemon.SdNotify(false, daemon.SdNotifyStopping); err != nil {
+		slog.Warn("failed to notify systemd", "err", err)
+	}
+}
+
+// progress 一个长期运行的协程最后一次报告进度的时间
+// 协程每次处理完一轮 select 都有机会报告，空闲时由 progressInterval 的计时器触发
+type progress struct {
+	name string
+	last atomic.Int64 // UnixNano，0 表示还没有开始运行
+}
+
+func (p *progress) beat() {
+	p.last.Store(time.Now().UnixNano())
+}
+
+// 看门狗关心的协程：发送协程不再领取日志时收集器会全部停住，调度协程卡住时日志不再送往发送协程
+// 写入 Kafka 在单独的写协程中，Kafka 不可用时发送协程和调度协程还会继续运行，不算卡住
+var (
+	senderProgress    = &progress{name: "kafka sender"}
+	schedulerProgress = &progress{name: "scheduler"}
+	watchedProgress   = []*progress{senderProgress, schedulerProgress}
+)
+
+const (
+	progressInterval = 5 * time.Second
+	// 超过这个时间没有报告进度就认为协程卡住了
+	hangTimeout = 3 * progressInterval
+)
+
+// hungProgress 找到卡住的协程，started 之前的进度按照 started 计算
+func hungProgress(started, now time.Time) (*progress, time.Duration) {
+	for _, p := range watchedProgress {
+		last := started
+		if beat := time.Unix(0, p.last.Load()); p.last.Load() != 0 && beat.After(started) {
+			last = beat
+		}
+		if stale := now.Sub(last); stale > hangTimeout {
+			return p, stale
+		}
+	}
+	return nil, 0
+}
+
+// watchdogLoop 配置了 WatchdogSec 时每半个周期喂一次狗
+// 发送协程或者调度协程超过 hangTimeout 没有报告进度时说明 bifrost 卡住了，这时不再喂狗，由 systemd 重启
+func (app *App) watchdogLoop(ctx context.Context) {
+	interval, err := daemon.SdWatchdogEnabled(false)
+	if err != nil {
+		slog.Warn("failed to read systemd watchdog", "err", err)
+		return
+	}
+	if interval <= 0 {
+		return
+	}
+
+	started := time.Now()
+	tick := time.NewTicker(interval / 2)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-tick.C:
+			if p, stale := hungProgress(started, now); p != nil {
+				slog.Error("no progress for a long time, stop feeding the systemd watchdog", "loop", p.name, "stale", stale.Round(time.Second))
+				continue
+			}
+			if _, err := daemon.SdNotify(false, daemon.SdNotifyWatchdog); err != nil {
+				slog.Warn("failed to notify systemd watchdog", "err", err)
+			}
+		}
+	}
+}
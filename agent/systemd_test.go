@@ -0,0 +1,42 @@
+package agent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHungProgress(t *testing.T) {
+	started := time.Now()
+	defer func() {
+		for _, p := range watchedProgress {
+			p.last.Store(0)
+		}
+	}()
+
+	tests := []struct {
+		name      string
+		sender    time.Duration // 距离启动多久报告的进度，负数表示还没有报告过
+		scheduler time.Duration
+		now       time.Duration
+		want      *progress
+	}{
+		{"just started", -1, -1, time.Second, nil},
+		{"never started", -1, -1, hangTimeout + time.Second, senderProgress},
+		{"both alive", time.Minute, time.Minute, time.Minute + progressInterval, nil},
+		{"scheduler hung", time.Minute, time.Second, time.Minute + progressInterval, schedulerProgress},
+		{"sender hung", time.Second, time.Minute, time.Minute + progressInterval, senderProgress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for p, at := range map[*progress]time.Duration{senderProgress: tt.sender, schedulerProgress: tt.scheduler} {
+				p.last.Store(0)
+				if at >= 0 {
+					p.last.Store(started.Add(at).UnixNano())
+				}
+			}
+			if got, _ := hungProgress(started, started.Add(tt.now)); got != tt.want {
+				t.Errorf("hungProgress() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
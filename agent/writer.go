@@ -2,7 +2,9 @@ package agent
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
+	"strconv"
 	"time"
 
 	"github.com/segmentio/kafka-go"
@@ -14,77 +16,332 @@ var (
 	LogChannel = make(chan *Log, 50)
 )
 
+const (
+	defaultBatchSize  = 1000
+	defaultBatchBytes = 1 << 20
+	defaultLinger     = 200 * time.Millisecond
+	// 退出时等待剩余批次写入 Kafka 的最长时间，超过后剩下的消息写入死信文件
+	// 要小于 senderExitTimeout，留出写死信文件的时间
+	senderDrainTimeout = 5 * time.Second
+)
+
+// batchOptions 批次的边界，条数、字节数、等待时间任意一个到达就发送
+type batchOptions struct {
+	size   int
+	bytes  int
+	linger time.Duration
+}
+
+func newBatchOptions(c conf.Kafka) batchOptions {
+	opts := batchOptions{size: c.QueueSize, bytes: c.BatchBytes, linger: c.Linger}
+	if opts.size <= 0 {
+		opts.size = defaultBatchSize
+	}
+	if opts.bytes <= 0 {
+		opts.bytes = defaultBatchBytes
+	}
+	if opts.linger <= 0 {
+		opts.linger = defaultLinger
+	}
+	return opts
+}
+
+// messageBatch 一个待发送的批次
+type messageBatch struct {
+	messages []kafka.Message
+	charges  []int64 // 每条消息占用的内存预算
+	bytes    int
+	offsets  map[*LogAgent]fileOffset // 批次写完后每个收集器可以推进到的位置
+}
+
+// fileOffset 收集器第 gen 次打开的文件中的位置
+type fileOffset struct {
+	gen, offset int64
+}
+
+func newMessageBatch(size int) *messageBatch {
+	return &messageBatch{messages: make([]kafka.Message, 0, size), charges: make([]int64, 0, size)}
+}
+
+func (b *messageBatch) add(msg kafka.Message, charge int64) {
+	b.messages = append(b.messages, msg)
+	b.charges = append(b.charges, charge)
+	b.bytes += messageSize(msg)
+}
+
+// evict 移除第一条 Key 为 key 的消息，返回它占用的内存预算
+func (b *messageBatch) evict(key string) (int64, bool) {
+	for i, msg := range b.messages {
+		if string(msg.Key) != key {
+			continue
+		}
+		charge := b.charges[i]
+		b.bytes -= messageSize(msg)
+		b.messages = append(b.messages[:i], b.messages[i+1:]...)
+		b.charges = append(b.charges[:i], b.charges[i+1:]...)
+		return charge, true
+	}
+	return 0, false
+}
+
+// advance 记录这条日志写完后收集器可以推进到的位置，被淘汰的日志也算处理完了
+func (b *messageBatch) advance(logmsg *Log) {
+	if logmsg.Source == nil || logmsg.Offset <= 0 {
+		return
+	}
+	if b.offsets == nil {
+		b.offsets = make(map[*LogAgent]fileOffset)
+	}
+	b.offsets[logmsg.Source] = fileOffset{gen: logmsg.FileGen, offset: logmsg.Offset}
+}
+
+// commit 批次写完后推进收集器的检查点
+func (b *messageBatch) commit() {
+	for source, o := range b.offsets {
+		source.commit(o.gen, o.offset)
+	}
+}
+
+// charged 整个批次占用的内存预算
+func (b *messageBatch) charged() int64 {
+	var total int64
+	for _, c := range b.charges {
+		total += c
+	}
+	return total
+}
+
+// batcher 把消息攒成批次，攒好的批次排队等待写协程领取
+type batcher struct {
+	opts    batchOptions
+	current *messageBatch
+	pending []*messageBatch
+	linger  *time.Timer // 当前批次的第一条消息到达时开始计时
+}
+
+func newBatcher(opts batchOptions) *batcher {
+	b := &batcher{opts: opts, current: newMessageBatch(opts.size), pending: make([]*messageBatch, 0), linger: time.NewTimer(opts.linger)}
+	stopTimer(b.linger)
+	return b
+}
+
+// add 放入一条消息，logmsg 是它对应的日志
+func (b *batcher) add(msg kafka.Message, logmsg *Log) {
+	// 再放一条就超过字节上限了，先把当前批次发出去
+	if len(b.current.messages) > 0 && b.current.bytes+messageSize(msg) > b.opts.bytes {
+		b.flush()
+	}
+	if len(b.current.messages) == 0 {
+		b.linger.Reset(b.opts.linger)
+	}
+	b.current.add(msg, logmsg.Size())
+	b.current.advance(logmsg)
+
+	if len(b.current.messages) >= b.opts.size || b.current.bytes >= b.opts.bytes {
+		b.flush()
+	}
+}
+
+// flush 结束当前批次，放进待发送的队列
+func (b *batcher) flush() {
+	if len(b.current.messages) == 0 {
+		return
+	}
+	stopTimer(b.linger)
+	b.pending = append(b.pending, b.current)
+	b.current = newMessageBatch(b.opts.size)
+}
+
+// evict 从最早的批次开始移除第一条 Key 为 key 的消息，正在写入的批次不在这里
+func (b *batcher) evict(key string) (int64, bool) {
+	for _, batch := range append(b.pending[:len(b.pending):len(b.pending)], b.current) {
+		if charge, ok := batch.evict(key); ok {
+			return charge, true
+		}
+	}
+	return 0, false
+}
+
+// logHeaders 在公共的 Header 之后加上这条日志自己的标记，没有标记时直接复用公共的 Header
+func logHeaders(base []kafka.Header, logmsg *Log) []kafka.Header {
+	if logmsg.Truncated == 0 && logmsg.Parts == 0 && !logmsg.Backfill && !logmsg.Replay {
+		return base
+	}
+	headers := make([]kafka.Header, len(base), len(base)+5)
+	copy(headers, base)
+	if logmsg.Backfill {
+		headers = append(headers, kafka.Header{Key: "backfill", Value: []byte("1")})
+	}
+	if logmsg.Replay {
+		headers = append(headers, kafka.Header{Key: "replay", Value: []byte("1")})
+	}
+	if logmsg.Truncated > 0 {
+		headers = append(headers, kafka.Header{Key: "truncated", Value: []byte(strconv.Itoa(logmsg.Truncated))})
+	}
+	if logmsg.Parts > 0 {
+		// 同一行切出来的几段有相同的 split_id，方便消费端拼回去
+		headers = append(headers,
+			kafka.Header{Key: "split", Value: []byte(fmt.Sprintf("%d/%d", logmsg.Part, logmsg.Parts))},
+			kafka.Header{Key: "split_id", Value: []byte(strconv.FormatInt(logmsg.CreatedAt.UnixNano(), 10))},
+		)
+	}
+	return headers
+}
+
+// messageSize 估算一条消息占用的字节数
+func messageSize(msg kafka.Message) int {
+	size := len(msg.Key) + len(msg.Value)
+	for _, h := range msg.Headers {
+		size += len(h.Key) + len(h.Value)
+	}
+	return size
+}
+
 // 队列生产者，将log转化成Kafka Message
+// 读取 LogChannel 和写入 Kafka 分别在两个协程中，写入慢的时候批次会在这里排队，不会阻塞收集
 func KafkaSender(ctx context.Context) {
+	opts := newBatchOptions(conf.APPConfig.Kafka)
+	writer := sender.InitWriter(opts.size, opts.bytes)
+	constHeaders := []kafka.Header{{Key: "source_agent", Value: []byte(conf.APPConfig.ID)}}
 
-	// 用来判断是否已经启动
-	var start bool
+	dead, err := newDeadLetter(writer, conf.APPConfig.DeadLetter)
+	if err != nil {
+		slog.Error("failed to open dead letter file", "err", err)
+		dead = &deadLetter{writer: writer, topic: conf.APPConfig.DeadLetter.Topic}
+	}
+	d := newDelivery(writer, dead, conf.APPConfig.Kafka)
 
-	tick := time.NewTicker(3 * time.Second)
-	MessageCollection := make([]kafka.Message, 0)
-	writer := sender.InitWriter()
-	bufferSize := conf.APPConfig.Kafka.QueueSize
-	constHeaders := []kafka.Header{{Key: "source_agent", Value: []byte(conf.APPConfig.ID)}}
+	// 写协程使用自己的 ctx，退出时再等待 senderDrainTimeout 才取消
+	deliverCtx, cancelDeliver := context.WithCancel(context.Background())
+	defer cancelDeliver()
+
+	batches := make(chan *messageBatch)
+	written := make(chan struct{})
+	go writeBatches(deliverCtx, d, batches, written)
+
+	b := newBatcher(opts)
+	// 每个收集器还欠着的淘汰条数
+	evictDebt := make(map[string]int)
+
+	appendLog := func(logmsg *Log) {
+		if key := logmsg.Source.Collector.Path; evictDebt[key] > 0 {
+			if evictDebt[key]--; evictDebt[key] == 0 {
+				delete(evictDebt, key)
+			}
+			budget.release(logmsg.Size())
+			droppedLines.Add(key, 1)
+			b.current.advance(logmsg)
+			logmsg.Reset()
+			return
+		}
+		msg := kafka.Message{
+			Key:     []byte(logmsg.Source.Collector.Path),
+			Value:   []byte(logmsg.Content),
+			Topic:   logmsg.Source.Collector.Topic,
+			Headers: logHeaders(constHeaders, logmsg),
+		}
+		b.add(msg, logmsg)
+		// 释放一下日志对象
+		logmsg.Reset()
+	}
+
+	// 淘汰某个收集器最早的一条还没有交给写协程的消息
+	// 找不到时(都还在队列中或者正在写入)记到 evictDebt 中，丢掉这个收集器下一条到达的日志，
+	// 最晚就是请求淘汰的那一条，这样强行占用的预算总能归还
+	evictOldest := func(key string) {
+		if charge, ok := b.evict(key); ok {
+			budget.release(charge)
+			droppedLines.Add(key, 1)
+			return
+		}
+		evictDebt[key]++
+	}
+
+	// 空闲时也定期报告进度，给 systemd 的看门狗使用
+	senderProgress.beat()
+	beat := time.NewTicker(progressInterval)
+	defer beat.Stop()
 
 	for {
+		// 只有存在待发送的批次时才打开发送通道
+		var out chan<- *messageBatch
+		var next *messageBatch
+		if len(b.pending) > 0 {
+			out = batches
+			next = b.pending[0]
+		}
+
 		select {
 		case <-ctx.Done():
-			log.Println("closeing Kafka Sender ")
-			tick.Stop()
+			slog.Info("closing kafka sender")
+			drainTimer := time.AfterFunc(senderDrainTimeout, cancelDeliver)
+			defer drainTimer.Stop()
+			// 把已经收到的日志全部发出去再退出
+			for drained := false; !drained; {
+				select {
+				case logmsg := <-LogChannel:
+					if logmsg != nil {
+						appendLog(logmsg)
+					}
+				default:
+					drained = true
+				}
+			}
+			b.flush()
+			for _, batch := range b.pending {
+				batches <- batch
+			}
+			close(batches)
+			<-written
+			if err := writer.Close(); err != nil {
+				slog.Warn("failed to close kafka writer", "err", err)
+			}
+			if err := dead.Close(); err != nil {
+				slog.Warn("failed to close dead letter file", "err", err)
+			}
 			return
 
-		case <-tick.C:
-			// 按照时间来判断缓冲区队列是否已满
-
-			currentLen := len(MessageCollection)
-
-			if currentLen != 0 && start {
-				var MessageBox = make([]kafka.Message, currentLen)
-				if currentLen > bufferSize {
-					// 装不下切割一下
-					copy(MessageBox, MessageCollection[:bufferSize])
-					MessageCollection = MessageCollection[bufferSize:]
-				} else {
-					// 如果缓冲区装得下，则全部写入
-					copy(MessageBox, MessageCollection)
-					MessageCollection = MessageCollection[:0]
-				}
+		case out <- next:
+			b.pending[0] = nil
+			b.pending = b.pending[1:]
 
-				log.Printf("Sender total %d\n", len(MessageBox))
-				err := writer.WriteMessages(ctx, MessageBox...)
-				if err != nil {
-					log.Println("failed to write messages:", err)
-				}
-			}
+		case <-b.linger.C:
+			// 等待时间到了，不管批次有没有攒满都发送
+			b.flush()
+
+		case <-beat.C:
+			senderProgress.beat()
+
+		case key := <-evictChan:
+			evictOldest(key)
 
 		case logmsg := <-LogChannel:
 			if logmsg == nil {
 				continue
 			}
-			MessageCollection = append(MessageCollection, kafka.Message{
-				Key:     []byte(logmsg.Source.Collector.Path),
-				Value:   []byte(logmsg.Content),
-				Topic:   logmsg.Source.Collector.Topic,
-				Headers: constHeaders,
-			})
-
-			// 释放一下日志对象
-			logmsg.Reset()
-			start = true
-
-			// 如果缓冲区装不下了，就触发写入
-			if len(MessageCollection) > bufferSize {
-				// 装不下切割一下
-				var MessageBox = make([]kafka.Message, bufferSize)
-				copy(MessageBox, MessageCollection[:bufferSize])
-				MessageCollection = MessageCollection[bufferSize:]
-				log.Printf("Sender total %d\n", len(MessageBox))
-				err := writer.WriteMessages(ctx, MessageBox...)
-				if err != nil {
-					log.Println("failed to write messages:", err)
-				}
-			}
+			appendLog(logmsg)
 		}
+	}
+}
+
+// writeBatches 写协程，依次把批次写入 Kafka，ctx 结束后剩下的批次直接写入死信文件
+func writeBatches(ctx context.Context, d *delivery, batches <-chan *messageBatch, written chan<- struct{}) {
+	defer close(written)
+	for batch := range batches {
+		slog.Debug("send batch", "messages", len(batch.messages))
+		d.deliver(ctx, batch.messages)
+		// 写完之后归还内存预算，暂停的收集器会被唤醒
+		budget.release(batch.charged())
+		batch.commit()
+	}
+}
 
+// stopTimer 停止计时器并清空已经触发的信号，保证下一次 Reset 是干净的
+func stopTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
 	}
 }
@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/y7ut/logagent/conf"
+)
+
+func TestNewBatchOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		c    conf.Kafka
+		want batchOptions
+	}{
+		{"defaults", conf.Kafka{}, batchOptions{size: defaultBatchSize, bytes: defaultBatchBytes, linger: defaultLinger}},
+		{"configured", conf.Kafka{QueueSize: 10, BatchBytes: 100, Linger: time.Second}, batchOptions{size: 10, bytes: 100, linger: time.Second}},
+		{"negative", conf.Kafka{QueueSize: -1, BatchBytes: -1, Linger: -time.Second}, batchOptions{size: defaultBatchSize, bytes: defaultBatchBytes, linger: defaultLinger}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newBatchOptions(tt.c); got != tt.want {
+				t.Errorf("newBatchOptions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatcherLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		bytes   int
+		values  []int // 每条消息的字节数
+		pending []int // 每个攒好的批次中的条数
+		current int
+	}{
+		{"under limits", 3, 100, []int{10, 10}, []int{}, 2},
+		{"by size", 2, 100, []int{10, 10, 10, 10, 10}, []int{2, 2}, 1},
+		{"reach bytes", 10, 20, []int{10, 10, 5}, []int{2}, 1},
+		{"exceed bytes", 10, 25, []int{10, 10, 10}, []int{2}, 1},
+		{"single message over bytes", 10, 20, []int{5, 30, 5}, []int{1, 1}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBatcher(batchOptions{size: tt.size, bytes: tt.bytes, linger: time.Hour})
+			for _, n := range tt.values {
+				value := strings.Repeat("x", n)
+				b.add(kafka.Message{Value: []byte(value)}, &Log{Content: value})
+			}
+			pending := make([]int, 0)
+			for _, batch := range b.pending {
+				pending = append(pending, len(batch.messages))
+				if batch.charged() != int64(batch.bytes) {
+					t.Errorf("batch charged %d, want %d", batch.charged(), batch.bytes)
+				}
+			}
+			if len(pending) != len(tt.pending) || len(b.current.messages) != tt.current {
+				t.Fatalf("pending batches %v, current %d, want %v, %d", pending, len(b.current.messages), tt.pending, tt.current)
+			}
+			for i := range pending {
+				if pending[i] != tt.pending[i] {
+					t.Errorf("pending batches %v, want %v", pending, tt.pending)
+				}
+			}
+		})
+	}
+}
+
+func TestBatcherLinger(t *testing.T) {
+	b := newBatcher(batchOptions{size: 2, bytes: 100, linger: 20 * time.Millisecond})
+	// 没有消息时不计时
+	select {
+	case <-b.linger.C:
+		t.Fatal("linger fired without messages")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	b.add(kafka.Message{Value: []byte("a")}, &Log{Content: "a"})
+	select {
+	case <-b.linger.C:
+		b.flush()
+	case <-time.After(time.Second):
+		t.Fatal("linger not fired")
+	}
+	if len(b.pending) != 1 || len(b.current.messages) != 0 {
+		t.Fatalf("pending %d batches, current %d messages, want 1, 0", len(b.pending), len(b.current.messages))
+	}
+
+	// 按条数发送后停止计时
+	b.add(kafka.Message{Value: []byte("b")}, &Log{Content: "b"})
+	b.add(kafka.Message{Value: []byte("c")}, &Log{Content: "c"})
+	select {
+	case <-b.linger.C:
+		t.Fatal("linger fired after the batch was flushed")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBatcherEvict(t *testing.T) {
+	b := newBatcher(batchOptions{size: 2, bytes: 100, linger: time.Hour})
+	for _, m := range []struct{ key, value string }{{"a", "1"}, {"b", "22"}, {"a", "333"}} {
+		b.add(kafka.Message{Key: []byte(m.key), Value: []byte(m.value)}, &Log{Content: m.value})
+	}
+
+	// 先淘汰最早的批次中的
+	if charge, ok := b.evict("a"); !ok || charge != 1 {
+		t.Fatalf("evict(a) = %d, %v, want 1, true", charge, ok)
+	}
+	if charge, ok := b.evict("a"); !ok || charge != 3 {
+		t.Fatalf("evict(a) = %d, %v, want 3, true", charge, ok)
+	}
+	if _, ok := b.evict("a"); ok {
+		t.Fatal("evict(a) found a message, want none left")
+	}
+	if batch := b.pending[0]; len(batch.messages) != 1 || batch.bytes != 3 || batch.charged() != 2 {
+		t.Errorf("pending batch has %d messages, %d bytes, %d charged, want 1, 3, 2", len(batch.messages), batch.bytes, batch.charged())
+	}
+}
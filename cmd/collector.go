@@ -1,12 +1,19 @@
 package cmd
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
-	tea "github.com/charmbracelet/bubbletea"
 	"github.com/spf13/cobra"
 	"github.com/y7ut/logagent/agent"
 	"github.com/y7ut/logagent/component/table"
@@ -25,17 +32,39 @@ var ListCollectorCmd = &cobra.Command{
 	},
 }
 
+// collectorRow list 中的一行，在收集器的配置之外加上文件的状态
+type collectorRow struct {
+	Path   string `json:"path" yaml:"path" gird_column:"路径" gird_sort:"1"`
+	Topic  string `json:"topic" yaml:"topic" gird_column:"日志主题" gird_sort:"2"`
+	Style  string `json:"style" yaml:"style" gird_column:"日志规则" gird_sort:"3"`
+	File   string `json:"file" yaml:"file" gird_column:"当前文件" gird_sort:"4"` // Date 类型是今天的文件
+	Exist  bool   `json:"exist" yaml:"exist" gird_column:"状态" gird_sort:"5"`
+	Size   int64  `json:"size" yaml:"size" gird_column:"文件大小" gird_sort:"6"`
+	Offset int64  `json:"offset" yaml:"offset" gird_column:"偏移" gird_sort:"7"`
+}
+
 func listCollectors(cmd *cobra.Command, args []string) {
 	configPath := cmd.Flag("config").Value.String()
 	checkconfig(configPath)
 
+	format, err := outputFormat(cmd)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
 	if err := ini.MapTo(conf.APPConfig, configPath); err != nil {
 		fmt.Printf("load ini file error: %s ", err)
 		return
 	}
 	etcd.Init()
 
-	collectorData, err := etcd.GetLogConfToEtcd()
+	if all, _ := cmd.Flags().GetBool("all"); all {
+		listFleet(cmd, format)
+		return
+	}
+
+	collectorData, _, err := etcd.GetCollectorConf(conf.APPConfig.ID)
 	if err != nil {
 		fmt.Printf("get etcd conf error: %s ", err)
 		return
@@ -50,41 +79,551 @@ func listCollectors(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	dataCollection := collection.New(collectors).Map(func(k int, item agent.Collector) agent.Collector {
-		if item.Style == "Date" {
-			item.Path = time.Now().Format(item.Path)
-		}
-		return item
-	}).Map(func(k int, item agent.Collector) agent.Collector {
-		_, err := os.Stat(item.Path)
-		if err != nil && os.IsNotExist(err) {
-			item.Exist = "❌"
-			return item
+	// 运行中的 bifrost 持有检查点的锁，这里只读
+	offsets := make(map[string]int64)
+	if checkpoints, err := agent.ListOffsets(conf.APPConfig.Runtime.Path); err == nil {
+		for _, cp := range checkpoints {
+			offsets[cp.Source] = cp.Offset
 		}
-		item.Exist = "✅"
-		return item
-	})
+	}
 
+	dataCollection := collection.New(collectors)
 	if cmd.Flag("filter").Value.String() != "" {
 		dataCollection.Filter(func(item agent.Collector) bool {
 			return item.Style == cmd.Flag("filter").Value.String()
 		})
 	}
 
-	oh := table.NewGrid(dataCollection.Value()).DefineHeader(map[string]string{
-		"Exist": "状态",
+	// 收集器很多时并行读取文件的状态，顺序保持不变
+	workers, _ := cmd.Flags().GetInt("workers")
+	rowCollection, err := collection.ParallelMapTo(cmd.Context(), dataCollection, workers, func(ctx context.Context, k int, item agent.Collector) (collectorRow, error) {
+		row := collectorRow{Path: item.Path, Topic: item.Topic, Style: item.Style, File: item.Path}
+		if item.Style == "Date" {
+			row.File = time.Now().Format(item.Path)
+		}
+		if stat, err := os.Stat(row.File); err == nil {
+			row.Exist = true
+			row.Size = stat.Size()
+		}
+		row.Offset = offsets[row.File]
+		return row, nil
 	})
+	if err != nil {
+		fmt.Printf("stat collectors error: %s ", err)
+		return
+	}
+	rows := rowCollection.Value()
+
+	if groupBy, _ := cmd.Flags().GetString("group-by"); groupBy != "" {
+		rows, err = groupRows(rows, groupBy, map[string]func(collectorRow) string{
+			"topic": func(r collectorRow) string { return r.Topic },
+			"style": func(r collectorRow) string { return r.Style },
+		}, collection.By(func(r collectorRow) string { return r.Path }))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	lines, _ := cmd.Flags().GetInt("lines")
+	if err := printGrid(format, rows, table.NewGrid(rows), collectorDetail(rows, lines)); err != nil {
+		fmt.Println("Error running program:", err)
+		os.Exit(1)
+	}
+}
+
+// 节点的运行状态
+const (
+	nodeActive   = "active"   // 运行中，心跳正常
+	nodeStale    = "stale"    // 标记为运行中，但是很久没有心跳了，可能已经崩溃
+	nodeInactive = "inactive" // 已经正常退出
+	nodeNever    = "never"    // 从来没有运行过
+)
+
+// fleetRow list --all 中的一行，一个节点的一个收集器
+type fleetRow struct {
+	Node      string `json:"node" yaml:"node" gird_column:"节点" gird_sort:"1"`
+	State     string `json:"state" yaml:"state" gird_column:"状态" gird_sort:"2"`
+	Heartbeat string `json:"heartbeat" yaml:"heartbeat" gird_column:"最后心跳" gird_sort:"3"`
+	Topic     string `json:"topic" yaml:"topic" gird_column:"日志主题" gird_sort:"4"`
+	Path      string `json:"path" yaml:"path" gird_column:"路径" gird_sort:"5"`
+	Style     string `json:"style" yaml:"style" gird_column:"日志规则" gird_sort:"6"`
+}
+
+// nodeState 根据激活状态和心跳判断节点的状态
+func nodeState(node etcd.Node) string {
+	switch node.Active {
+	case "1":
+		// 超过三个心跳周期没有心跳
+		if node.Heartbeat.IsZero() || time.Since(node.Heartbeat) > 3*etcd.HeartbeatInterval {
+			return nodeStale
+		}
+		return nodeActive
+	case "":
+		return nodeNever
+	default:
+		return nodeInactive
+	}
+}
+
+// listFleet 列出所有节点的收集器，按照节点或者主题分组
+func listFleet(cmd *cobra.Command, format string) {
+	nodes, err := etcd.ListNodes()
+	if err != nil {
+		fmt.Printf("get etcd conf error: %s ", err)
+		return
+	}
+	groupBy, _ := cmd.Flags().GetString("group-by")
+	style := cmd.Flag("filter").Value.String()
+
+	rows := make([]fleetRow, 0)
+	for _, node := range nodes {
+		base := fleetRow{Node: node.ID, State: nodeState(node), Heartbeat: "-"}
+		if !node.Heartbeat.IsZero() {
+			base.Heartbeat = node.Heartbeat.Local().Format(time.DateTime)
+		}
 
-	tableDemo := table.Create(oh)
-	if _, err := tea.NewProgram(tableDemo).Run(); err != nil {
+		collectors := make([]agent.Collector, 0)
+		if len(node.Config) > 0 {
+			if err := json.Unmarshal(node.Config, &collectors); err != nil {
+				// 配置坏掉的节点也要展示出来
+				row := base
+				row.Path = fmt.Sprintf("unmarshal error: %s", err)
+				rows = append(rows, row)
+				continue
+			}
+		}
+		if len(collectors) == 0 && style == "" {
+			// 没有收集器的节点单独占一行
+			rows = append(rows, base)
+			continue
+		}
+		for _, collector := range collectors {
+			if style != "" && collector.Style != style {
+				continue
+			}
+			row := base
+			row.Topic, row.Path, row.Style = collector.Topic, collector.Path, collector.Style
+			rows = append(rows, row)
+		}
+	}
+
+	if groupBy == "" {
+		groupBy = "node"
+	}
+	rows, err = groupRows(rows, groupBy, map[string]func(fleetRow) string{
+		"node":  func(r fleetRow) string { return r.Node },
+		"topic": func(r fleetRow) string { return r.Topic },
+		"style": func(r fleetRow) string { return r.Style },
+	}, collection.By(func(r fleetRow) string { return r.Node }),
+		collection.By(func(r fleetRow) string { return r.Topic }),
+		collection.By(func(r fleetRow) string { return r.Path }))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if err := printGrid(format, rows, table.NewGrid(rows), nil); err != nil {
 		fmt.Println("Error running program:", err)
 		os.Exit(1)
 	}
+}
+
+// groupRows 按照 groupBy 对应的列分组，组按照名字排序，组内按照 order 排序
+func groupRows[T any](rows []T, groupBy string, keys map[string]func(T) string, order ...func(a, b T) int) ([]T, error) {
+	key, ok := keys[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("group-by(%s) must be one of %s", groupBy, strings.Join(slices.Sorted(maps.Keys(keys)), ", "))
+	}
+	groups := collection.GroupBy(collection.New(rows), key)
+	result := make([]T, 0, len(rows))
+	for _, name := range slices.Sorted(maps.Keys(groups)) {
+		result = append(result, groups[name].SortBy(order...).Value()...)
+	}
+	return result, nil
+}
+
+// collectorDetail 收集器的详情：文件状态、读取进度和最后几行
+func collectorDetail(rows []collectorRow, lines int) table.DetailFunc {
+	byPath := make(map[string]collectorRow, len(rows))
+	for _, row := range rows {
+		byPath[row.Path] = row
+	}
+	return func(selected []string) ([]string, error) {
+		item, ok := byPath[selected[0]]
+		if !ok {
+			return nil, fmt.Errorf("collector %s not found", selected[0])
+		}
+		result := []string{
+			fmt.Sprintf("当前文件: %s", item.File),
+			fmt.Sprintf("日志主题: %s  日志规则: %s", item.Topic, item.Style),
+		}
+
+		stat, err := os.Stat(item.File)
+		if err != nil {
+			return append(result, fmt.Sprintf("文件状态: %s", err)), nil
+		}
+		// 每次都重新读取，跟随模式下可以看到进度的变化
+		var offset int64
+		if checkpoints, err := agent.ListOffsets(conf.APPConfig.Runtime.Path); err == nil {
+			for _, cp := range checkpoints {
+				if cp.Source == item.File {
+					offset = cp.Offset
+				}
+			}
+		}
+		result = append(result,
+			fmt.Sprintf("文件大小: %d  修改时间: %s  权限: %s", stat.Size(), stat.ModTime().Format(time.DateTime), stat.Mode()),
+			fmt.Sprintf("偏移: %d  未读字节: %d", offset, stat.Size()-offset),
+			"",
+			fmt.Sprintf("最后 %d 行:", lines),
+		)
+
+		f, err := os.Open(item.File)
+		if err != nil {
+			return append(result, err.Error()), nil
+		}
+		defer f.Close()
+		tail, err := tailLines(f, lines)
+		if err != nil {
+			return append(result, err.Error()), nil
+		}
+		return append(result, tail...), nil
+	}
+}
 
+var CollectorCommand = &cobra.Command{
+	Use:   "collector",
+	Short: "Add, remove or edit collectors of a node in etcd",
+	Long: `Add, remove or edit collectors in /logagent/config/<id>.
+The collector is validated and a diff is shown before the change is written,
+the change is only applied if nobody else modified the config in the meantime.
+
+  ./bifrost collector add --path /var/log/app.log --topic app_log
+  ./bifrost collector edit /var/log/app.log --set rate_lines=1000 --set over_limit=sample
+  ./bifrost collector remove /var/log/app.log --id node_2`,
+}
+
+var addCollectorCommand = &cobra.Command{
+	Use:          "add",
+	SilenceUsage: true,
+	Short:        "Add a collector",
+	Args:         cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return addCollector(cmd, args)
+	},
+}
+
+var removeCollectorCommand = &cobra.Command{
+	Use:          "remove <path>",
+	SilenceUsage: true,
+	Short:        "Remove the collector of path",
+	Args:         cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return removeCollector(cmd, args)
+	},
+}
+
+var editCollectorCommand = &cobra.Command{
+	Use:          "edit <path>",
+	SilenceUsage: true,
+	Short:        "Edit the collector of path, only given flags are changed",
+	Args:         cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return editCollector(cmd, args)
+	},
+}
+
+func addCollector(cmd *cobra.Command, args []string) error {
+	return updateCollectors(cmd, func(collectors []agent.Collector) ([]agent.Collector, error) {
+		collector, err := applyCollectorFlags(cmd, agent.Collector{})
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := indexCollector(collectors, collector.Path); ok {
+			return nil, fmt.Errorf("collector %s already exists, use edit instead", collector.Path)
+		}
+		return append(collectors, collector), nil
+	})
+}
+
+func removeCollector(cmd *cobra.Command, args []string) error {
+	return updateCollectors(cmd, func(collectors []agent.Collector) ([]agent.Collector, error) {
+		i, ok := indexCollector(collectors, args[0])
+		if !ok {
+			return nil, fmt.Errorf("collector %s not found", args[0])
+		}
+		return append(collectors[:i], collectors[i+1:]...), nil
+	})
+}
+
+func editCollector(cmd *cobra.Command, args []string) error {
+	return updateCollectors(cmd, func(collectors []agent.Collector) ([]agent.Collector, error) {
+		i, ok := indexCollector(collectors, args[0])
+		if !ok {
+			return nil, fmt.Errorf("collector %s not found", args[0])
+		}
+		collector, err := applyCollectorFlags(cmd, collectors[i])
+		if err != nil {
+			return nil, err
+		}
+		if j, ok := indexCollector(collectors, collector.Path); ok && j != i {
+			return nil, fmt.Errorf("collector %s already exists", collector.Path)
+		}
+		collectors[i] = collector
+		return collectors, nil
+	})
+}
+
+// updateCollectors 读取节点的收集器配置，修改后展示差异，确认后用 revision 做 CAS 写回
+func updateCollectors(cmd *cobra.Command, change func([]agent.Collector) ([]agent.Collector, error)) error {
+	configPath := cmd.Flag("config").Value.String()
+	checkconfig(configPath)
+
+	if err := ini.MapTo(conf.APPConfig, configPath); err != nil {
+		return fmt.Errorf("load ini file error: %s", err)
+	}
+	id, _ := cmd.Flags().GetString("id")
+	if id == "" {
+		id = conf.APPConfig.ID
+	}
+	etcd.Init()
+
+	collectorData, rev, err := etcd.GetCollectorConf(id)
+	if err != nil {
+		return fmt.Errorf("get etcd conf error: %s", err)
+	}
+
+	collectors := make([]agent.Collector, 0)
+	if len(bytes.TrimSpace(collectorData)) > 0 {
+		if err := json.Unmarshal(collectorData, &collectors); err != nil {
+			return fmt.Errorf("config of agent %s is broken, unmarshal error: %s", id, err)
+		}
+	}
+
+	before := renderCollectors(collectors)
+	updated, err := change(append([]agent.Collector{}, collectors...))
+	if err != nil {
+		return err
+	}
+	after := renderCollectors(updated)
+
+	changes := diffLines(before, after)
+	if len(changes) == 0 {
+		fmt.Println("nothing changed")
+		return nil
+	}
+	if rev == 0 {
+		fmt.Printf("agent %s (not registered, will be created):\n", id)
+	} else {
+		fmt.Printf("agent %s (revision %d):\n", id, rev)
+	}
+	for _, line := range changes {
+		fmt.Println(line)
+	}
+
+	if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+		return nil
+	}
+	if yes, _ := cmd.Flags().GetBool("yes"); !yes {
+		fmt.Print("apply this change? [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			fmt.Println("canceled")
+			return nil
+		}
+	}
+
+	value, err := json.Marshal(updated)
+	if err != nil {
+		return err
+	}
+	ok, err := etcd.PutCollectorConf(id, value, rev)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("config of agent %s was modified by others after revision %d, please retry", id, rev)
+	}
+	fmt.Printf("🎏 config of agent %s updated\n", id)
+	return nil
+}
+
+// applyCollectorFlags 把命令行中指定了的字段写入收集器，并检查结果
+// --set key=value 可以修改 json 中的任意字段，value 为空时清除这个字段
+func applyCollectorFlags(cmd *cobra.Command, collector agent.Collector) (agent.Collector, error) {
+	if cmd.Flags().Changed("style") {
+		collector.Style, _ = cmd.Flags().GetString("style")
+	}
+	if cmd.Flags().Changed("path") {
+		collector.Path, _ = cmd.Flags().GetString("path")
+	}
+	if cmd.Flags().Changed("topic") {
+		collector.Topic, _ = cmd.Flags().GetString("topic")
+	}
+
+	sets, _ := cmd.Flags().GetStringArray("set")
+	if len(sets) > 0 {
+		raw, err := json.Marshal(collector)
+		if err != nil {
+			return collector, err
+		}
+		fields := make(map[string]interface{})
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return collector, err
+		}
+		for _, set := range sets {
+			key, value, ok := strings.Cut(set, "=")
+			if !ok || key == "" {
+				return collector, fmt.Errorf("set(%s) format error, want key=value", set)
+			}
+			if value == "" {
+				delete(fields, key)
+				continue
+			}
+			parsed, err := parseCollectorField(key, value)
+			if err != nil {
+				return collector, fmt.Errorf("set(%s) error: %s", set, err)
+			}
+			fields[key] = parsed
+		}
+
+		raw, err = json.Marshal(fields)
+		if err != nil {
+			return collector, err
+		}
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		collector = agent.Collector{}
+		if err := decoder.Decode(&collector); err != nil {
+			return collector, fmt.Errorf("set error: %s", err)
+		}
+	}
+
+	if collector.Style == "" {
+		collector.Style = "File"
+	}
+	return collector, collector.Validate()
+}
+
+// collectorFieldKinds 收集器 json 中每个字段的类型
+func collectorFieldKinds() map[string]reflect.Kind {
+	t := reflect.TypeOf(agent.Collector{})
+	kinds := make(map[string]reflect.Kind, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		kinds[name] = t.Field(i).Type.Kind()
+	}
+	return kinds
+}
+
+// parseCollectorField 按照字段的类型解析 --set 的值，topic=2023 这样的值仍然是字符串
+// 不认识的字段原样保留，之后解码时报错
+func parseCollectorField(key, value string) (interface{}, error) {
+	switch collectorFieldKinds()[key] {
+	case reflect.String:
+		return value, nil
+	case reflect.Bool:
+		return strconv.ParseBool(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(value, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(value, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(value, 64)
+	default:
+		return value, nil
+	}
+}
+
+func indexCollector(collectors []agent.Collector, path string) (int, bool) {
+	for i, collector := range collectors {
+		if collector.Path == path {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// renderCollectors 每个收集器渲染成一行 json，用来展示差异
+func renderCollectors(collectors []agent.Collector) []string {
+	lines := make([]string, 0, len(collectors))
+	for _, collector := range collectors {
+		line, _ := json.Marshal(collector)
+		lines = append(lines, string(line))
+	}
+	return lines
+}
+
+// diffLines 基于最长公共子序列的逐行差异，没有变化时返回空
+func diffLines(before, after []string) []string {
+	lcs := make([][]int, len(before)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			switch {
+			case before[i] == after[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] > lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	result := make([]string, 0, len(before)+len(after))
+	changed := false
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && before[i] == after[j]:
+			result = append(result, "  "+before[i])
+			i++
+			j++
+		case j < len(after) && (i == len(before) || lcs[i][j+1] > lcs[i+1][j]):
+			result = append(result, "+ "+after[j])
+			changed = true
+			j++
+		default:
+			result = append(result, "- "+before[i])
+			changed = true
+			i++
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return result
 }
 
 func init() {
 	ListCollectorCmd.Flags().StringP("config", "c", "./bifrost.conf", "config bifrost file")
 	ListCollectorCmd.Flags().StringP("filter", "f", "", "filter collector")
+	ListCollectorCmd.Flags().BoolP("all", "a", false, "list collectors of all agents with their state and last heartbeat")
+	ListCollectorCmd.Flags().String("group-by", "", "group rows by topic or style, --all can also group by node which is the default")
+	ListCollectorCmd.Flags().Int("lines", 20, "number of last lines in the detail view")
+	ListCollectorCmd.Flags().Int("workers", 0, "number of files checked in parallel, defaults to the number of CPUs")
+	ListCollectorCmd.Flags().StringP("output", "o", OutputTable, "output format: table, json, yaml, csv or plain, plain when stdout is not a terminal")
 	RootCmd.AddCommand(ListCollectorCmd)
+
+	CollectorCommand.PersistentFlags().StringP("config", "c", "./bifrost.conf", "config bifrost file")
+	CollectorCommand.PersistentFlags().String("id", "", "id of the agent to change, defaults to logagent_id of the config")
+	CollectorCommand.PersistentFlags().BoolP("yes", "y", false, "apply without confirmation")
+	CollectorCommand.PersistentFlags().Bool("dry-run", false, "only show the diff")
+	for _, c := range []*cobra.Command{addCollectorCommand, editCollectorCommand} {
+		c.Flags().String("style", "File", "style of the collector: File or Date")
+		c.Flags().String("path", "", "path of the log file, Date style uses a Go time layout like /var/log/app-2006-01-02.log")
+		c.Flags().String("topic", "", "kafka topic")
+		c.Flags().StringArray("set", nil, "other fields as key=value, e.g. rate_lines=1000, empty value clears the field")
+	}
+	addCollectorCommand.MarkFlagRequired("path")
+	addCollectorCommand.MarkFlagRequired("topic")
+	CollectorCommand.AddCommand(addCollectorCommand, removeCollectorCommand, editCollectorCommand)
+	RootCmd.AddCommand(CollectorCommand)
 }
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/y7ut/logagent/agent"
+)
+
+func TestApplyCollectorSet(t *testing.T) {
+	base := agent.Collector{Style: "File", Path: "/var/log/app.log", Topic: "app"}
+	tests := []struct {
+		name    string
+		sets    []string
+		want    func(c agent.Collector) bool
+		wantErr bool
+	}{
+		{"numeric topic stays a string", []string{"topic=2023"}, func(c agent.Collector) bool { return c.Topic == "2023" }, false},
+		{"boolean-like topic stays a string", []string{"topic=true"}, func(c agent.Collector) bool { return c.Topic == "true" }, false},
+		{"int field", []string{"rate_lines=1000"}, func(c agent.Collector) bool { return c.RateLines == 1000 }, false},
+		{"bool field", []string{"backfill=true"}, func(c agent.Collector) bool { return c.Backfill }, false},
+		{"clear field", []string{"rate_lines=1000", "rate_lines="}, func(c agent.Collector) bool { return c.RateLines == 0 }, false},
+		{"int field with text", []string{"rate_lines=fast"}, nil, true},
+		{"bool field with text", []string{"backfill=yes"}, nil, true},
+		{"unknown field", []string{"unknown=1"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().StringArray("set", nil, "")
+			for _, set := range tt.sets {
+				if err := cmd.Flags().Set("set", set); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := applyCollectorFlags(cmd, base)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("applyCollectorFlags(%q) = %+v, want an error", tt.sets, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.want(got) {
+				t.Errorf("applyCollectorFlags(%q) = %+v", tt.sets, got)
+			}
+		})
+	}
+}
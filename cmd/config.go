@@ -65,6 +65,11 @@ func ParseConfig(helper bool) *ini.File {
 	cfg.Section("kafka").Comment = "Kafka connection string"
 	cfg.Section("kafka").NewKey("address", kafkaConn)
 	cfg.Section("kafka").NewKey("queue_size", queueSize)
+	cfg.Section("kafka").NewKey("batch_bytes", "1048576")
+	cfg.Section("kafka").NewKey("linger", "200ms")
+	cfg.Section("kafka").NewKey("memory_limit", "67108864")
+	cfg.Section("kafka").NewKey("max_retries", "3")
+	cfg.Section("kafka").NewKey("retry_backoff", "1s")
 
 	cfg.Section("etcd").Comment = "Etcd connection string"
 	cfg.Section("etcd").NewKey("address", etcdConn)
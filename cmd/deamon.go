@@ -58,6 +58,12 @@ func startProcess(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to start Bifrost: Bifrost is already exists in pid[%d]", pid)
 	}
 
+	// 安装成 systemd 服务之后由 systemd 管理进程
+	if _, err := os.Stat(unitPath(cmd)); err == nil {
+		name, _ := cmd.Flags().GetString("name")
+		return fmt.Errorf("bifrost is installed as a systemd service, use `systemctl start %s` instead", name)
+	}
+
 	configPath := cmd.Flag("config").Value.String()
 	checkconfig(configPath)
 
@@ -158,6 +164,11 @@ func daemonStart() (int, error) {
 func init() {
 	startCmd.Flags().StringP("config", "c", "./bifrost.conf", "config bifrost file")
 	restartCmd.Flags().StringP("config", "c", "./bifrost.conf", "config bifrost file")
+	// 和 service install 一样，用来判断是否已经安装成 systemd 服务
+	for _, c := range []*cobra.Command{startCmd, restartCmd} {
+		c.Flags().String("name", defaultServiceName, "name of the systemd unit")
+		c.Flags().String("unit-dir", defaultUnitDir, "directory of the systemd unit")
+	}
 	RootCmd.AddCommand(startCmd)
 	RootCmd.AddCommand(stopCmd)
 	RootCmd.AddCommand(restartCmd)
@@ -1,130 +1,320 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"iter"
+	"log/slog"
 	"os"
 	"os/signal"
+	"regexp"
+	"slices"
 	"syscall"
+	"time"
 
 	"github.com/hpcloud/tail"
 	"github.com/spf13/cobra"
+	"github.com/y7ut/logagent/agent"
+	"github.com/y7ut/logagent/conf"
+	"github.com/y7ut/logagent/pkg/file"
+	"gopkg.in/ini.v1"
 )
 
 var (
-	logFile = "./runtime/log/bifrost.log"
-	num     int
-	feed    bool
+	num  int
+	feed bool
 )
 
 // VersionCmd represents the version command
 var LogCommand = &cobra.Command{
 	Use:   "logs",
 	Short: "Show logs of Bifrost",
-	Run: func(cmd *cobra.Command, args []string) {
-		logs()
+	Long: `Show logs of Bifrost from the [log] path of the config. Rotated files are read too
+when the current file has not enough lines.`,
+	Example: `  bifrost logs -n 20 --level warn
+  bifrost logs --since 1h --grep topic=nginx
+  bifrost logs --since "2023-06-01 10:00:00" --until "2023-06-01 11:00:00"
+  bifrost logs -f`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return logs(cmd, args)
 	},
 }
 
-func logs() {
-	loggg, err := os.Open(logFile)
-	if err != nil {
-		fmt.Println(err)
-	}
-	stat, _ := loggg.Stat()
-	// 获取文件的字节大小
-	endOffset := stat.Size()
-
-	if feed && num == 0 {
-		num = 5
-	}
-	PrintlnTaillF(loggg, num)
-	// offset := TailNWithScanner(loggg, num)
-
-	if feed {
-		config := tail.Config{
-			ReOpen:    false, // true则文件被删掉阻塞等待新建该文件，false则文件被删掉时程序结束
-			Follow:    true,  // true则一直阻塞并监听指定文件，false则一次读完就结束程序
-			Location:  &tail.SeekInfo{Offset: endOffset, Whence: 0},
-			MustExist: true, // true则没有找到文件就报错并结束，false则没有找到文件就阻塞保持住
-			Poll:      true, // 使用Linux的Poll函数，poll的作用是把当前的文件指针挂到等待队列
-			Logger:    tail.DiscardingLogger,
+// 倒着读文件时每次读取的大小
+const reverseBlockSize = 64 << 10
+
+// logFilter 日志的过滤条件，零值不过滤
+type logFilter struct {
+	since, until time.Time
+	grep         *regexp.Regexp
+	level        *slog.Level
+}
+
+// match 时间和级别只对能解析出来的行生效，解析不出来的行只有 grep 能过滤
+func (f logFilter) match(entry logEntry) bool {
+	if f.grep != nil && !f.grep.MatchString(entry.Raw) {
+		return false
+	}
+	if f.level != nil && (!entry.HasLevel || entry.Level < *f.level) {
+		return false
+	}
+	if !entry.Time.IsZero() {
+		if !f.since.IsZero() && entry.Time.Before(f.since) {
+			return false
+		}
+		if !f.until.IsZero() && entry.Time.After(f.until) {
+			return false
 		}
-		tailer, err := tail.TailFile(logFile, config)
+	}
+	return true
+}
 
+// parseLogTime 支持 10m 这样的时长，表示 now 之前，也支持具体的时间
+func parseLogTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.DateTime, time.RFC3339, "2006-01-02T15:04:05", time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("time(%s) must be a duration like 10m or a time like 2006-01-02 15:04:05", s)
+}
+
+func parseLogFilter(cmd *cobra.Command) (logFilter, error) {
+	var (
+		f   logFilter
+		err error
+	)
+	now := time.Now()
+	since, _ := cmd.Flags().GetString("since")
+	if f.since, err = parseLogTime(since, now); err != nil {
+		return f, err
+	}
+	until, _ := cmd.Flags().GetString("until")
+	if f.until, err = parseLogTime(until, now); err != nil {
+		return f, err
+	}
+	if grep, _ := cmd.Flags().GetString("grep"); grep != "" {
+		if f.grep, err = regexp.Compile(grep); err != nil {
+			return f, fmt.Errorf("grep(%s) format error: %s", grep, err)
+		}
+	}
+	if level, _ := cmd.Flags().GetString("level"); level != "" {
+		l, err := agent.ParseLogLevel(level)
 		if err != nil {
-			fmt.Println(err)
+			return f, err
+		}
+		f.level = &l
+	}
+	return f, nil
+}
+
+func logs(cmd *cobra.Command, args []string) error {
+	configPath := cmd.Flag("config").Value.String()
+	checkconfig(configPath)
+
+	if err := ini.MapTo(conf.APPConfig, configPath); err != nil {
+		return fmt.Errorf("load ini file error: %s", err)
+	}
+	logFile := agent.LogFile(conf.APPConfig.Log)
+
+	filter, err := parseLogFilter(cmd)
+	if err != nil {
+		return err
+	}
+	// 指定了时间范围而没有指定行数时，输出范围内所有的行
+	if !cmd.Flags().Changed("number") && !filter.since.IsZero() {
+		num = 0
+	}
+	raw, _ := cmd.Flags().GetBool("raw")
+	output := func(entry logEntry) {
+		if raw {
+			fmt.Println(entry.Raw)
 			return
 		}
+		fmt.Println(prettyLogLine(entry))
+	}
 
-		go func() {
-			for {
-				line := <-tailer.Lines
-				fmt.Println(line.Text)
-			}
-		}()
+	endOffset, err := printHistory(logFile, num, filter, output)
+	if err != nil && !(feed && os.IsNotExist(err)) {
+		return err
+	}
+	if !feed {
+		return nil
+	}
 
-		for s := range sign() {
-			switch s {
-			case syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM:
-				// log.Println("Safe Exit:", s)
-				return
+	config := tail.Config{
+		ReOpen:    true, // 日志轮转后重新打开新的文件
+		Follow:    true, // true则一直阻塞并监听指定文件，false则一次读完就结束程序
+		Location:  &tail.SeekInfo{Offset: endOffset, Whence: io.SeekStart},
+		MustExist: false, // 文件还没有创建时等待
+		Poll:      true,  // 轮询文件的变化，轮转后的新文件也能发现
+		Logger:    tail.DiscardingLogger,
+	}
+	tailer, err := tail.TailFile(logFile, config)
+	if err != nil {
+		return err
+	}
+	defer tailer.Cleanup()
+
+	go func() {
+		for line := range tailer.Lines {
+			if line.Err != nil {
+				continue
+			}
+			if entry := parseLogLine(line.Text); filter.match(entry) {
+				output(entry)
 			}
 		}
+	}()
+
+	for s := range sign() {
+		switch s {
+		case syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM:
+			return tailer.Stop()
+		}
 	}
+	return nil
 }
 
-func PrintlnTaillF(logFile *os.File, length int) {
-	lines := tailLinesSliceOfFile(logFile, length)
-	for k := range lines {
-		fmt.Print(lines[len(lines)-k-1])
+// printHistory 从新到旧读取当前的日志和轮转的日志，输出最后 n 行符合条件的日志，n 为 0 时不限制。
+// 返回当前日志文件的大小，跟随输出从这里开始
+func printHistory(logFile string, n int, filter logFilter, output func(logEntry)) (int64, error) {
+	f, err := os.Open(logFile)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, err
 	}
-}
 
-func tailLinesSliceOfFile(logFile *os.File, length int) []string {
-	stat, _ := logFile.Stat()
-	// 获取文件的字节大小
-	endOffset := stat.Size()
-	// 记录已经读取的字节数
-	var offset int64 = -1
-	// 制作一个缓冲区用于从末尾读取文件
-	lineBuilder := make([]byte, 0)
-	// 记录读取的行
-	lines := make([]string, 0, length)
-	for endOffset-(-offset) > 0 {
-		tmpByte := make([]byte, 1)
-		// 从末尾读取文件
-		logFile.Seek(offset, io.SeekEnd)
-		_, err := logFile.Read(tmpByte)
+	files := []io.ReaderAt{f}
+	sizes := []int64{stat.Size()}
+	backups, _ := file.Backups(logFile)
+	for _, backup := range backups {
+		bf, err := os.Open(backup.Path)
 		if err != nil {
-			break
+			continue
 		}
-		// offset -1 是文件EOF前的最后一个字节，直接跳过
-		if offset == -1 {
-			offset--
+		defer bf.Close()
+		bstat, err := bf.Stat()
+		if err != nil {
 			continue
 		}
-		// 如果遇到换行符了，证明到了一行的末尾
-		if tmpByte[0] == '\n' {
-			if len(lines) >= length {
-				break
+		files, sizes = append(files, bf), append(sizes, bstat.Size())
+	}
+
+	matched := make([]logEntry, 0, n)
+read:
+	for k, r := range files {
+		for line, err := range reverseLines(r, sizes[k]) {
+			if err != nil {
+				return stat.Size(), err
+			}
+			entry := parseLogLine(line)
+			// 日志按时间写入，读到早于 since 的行就不用再往前读了
+			if !filter.since.IsZero() && !entry.Time.IsZero() && entry.Time.Before(filter.since) {
+				break read
+			}
+			if !filter.match(entry) {
+				continue
 			}
-			// 打包缓冲区，制作一个带\n的字符串，并存入读取的行记录中
-			lineBuilder = append(lineBuilder, tmpByte[0])
-			lines = append(lines, string(lineBuilder))
-			lineBuilder = lineBuilder[:0]
-		} else {
-			// 将每次读到的字节都写进缓冲区的头部
-			lineBuilder = append(tmpByte, lineBuilder...)
+			matched = append(matched, entry)
+			if n > 0 && len(matched) >= n {
+				break read
+			}
+		}
+	}
+
+	slices.Reverse(matched)
+	for _, entry := range matched {
+		output(entry)
+	}
+	return stat.Size(), nil
+}
+
+// reverseLines 从 size 处往前按块读取，从最后一行开始返回，不包含换行符。
+// 文件末尾的换行不算作一行
+func reverseLines(r io.ReaderAt, size int64) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		var (
+			rest []byte // 上一块开头不完整的行
+			end  = size
+			last = true
+		)
+		for end > 0 {
+			start := max(0, end-reverseBlockSize)
+			block := make([]byte, end-start, end-start+int64(len(rest)))
+			if _, err := r.ReadAt(block, start); err != nil && err != io.EOF {
+				yield("", err)
+				return
+			}
+			block = append(block, rest...)
+			end = start
+
+			for {
+				i := bytes.LastIndexByte(block, '\n')
+				if i < 0 {
+					break
+				}
+				line := block[i+1:]
+				block = block[:i]
+				if last && len(line) == 0 {
+					last = false
+					continue
+				}
+				last = false
+				if !yield(string(line), nil) {
+					return
+				}
+			}
+			rest = block
+		}
+		// 读到文件开头了，剩下的就是第一行
+		if len(rest) > 0 {
+			yield(string(rest), nil)
+		}
+	}
+}
+
+// tailLines 读取文件的最后 n 行，按照原来的顺序返回
+func tailLines(f *os.File, n int) ([]string, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]string, 0, n)
+	for line, err := range reverseLines(f, stat.Size()) {
+		if err != nil {
+			return nil, err
+		}
+		if len(lines) >= n {
+			break
 		}
-		offset--
+		lines = append(lines, line)
 	}
-	return lines
+	slices.Reverse(lines)
+	return lines, nil
 }
 
 func init() {
-	LogCommand.Flags().IntVarP(&num, "number", "n", 5, "get last number line of logs")
-	LogCommand.Flags().BoolVarP(&feed, "feed", "f", false, "feed logs")
+	LogCommand.Flags().StringP("config", "c", "./bifrost.conf", "config bifrost file")
+	LogCommand.Flags().IntVarP(&num, "number", "n", 5, "get last number line of logs, 0 for all")
+	LogCommand.Flags().BoolVarP(&feed, "feed", "f", false, "feed logs, keeps following after the log is rotated")
+	LogCommand.Flags().String("since", "", "show logs after a time like 2006-01-02 15:04:05 or a duration ago like 1h")
+	LogCommand.Flags().String("until", "", "show logs before a time like 2006-01-02 15:04:05 or a duration ago like 10m")
+	LogCommand.Flags().String("grep", "", "show logs matching the regexp")
+	LogCommand.Flags().String("level", "", "show logs at or above the level: debug, info, warn or error")
+	LogCommand.Flags().Bool("raw", false, "print logs as they are in the file")
 	RootCmd.AddCommand(LogCommand)
 }
 
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReverseLines(t *testing.T) {
+	long := strings.Repeat("x", reverseBlockSize+10)
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"empty", "", nil},
+		{"trailing newline", "a\nb\nc\n", []string{"c", "b", "a"}},
+		{"no trailing newline", "a\nb", []string{"b", "a"}},
+		{"empty lines", "a\n\nb\n", []string{"b", "", "a"}},
+		{"across blocks", "a\n" + long + "\nb\n", []string{"b", long, "a"}},
+		{"newline at block boundary", strings.Repeat("y", reverseBlockSize-1) + "\nz\n", []string{"z", strings.Repeat("y", reverseBlockSize-1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for line, err := range reverseLines(strings.NewReader(tt.content), int64(len(tt.content))) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, line)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %d lines %.20q, want %d lines %.20q", len(got), got, len(tt.want), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLogLine(t *testing.T) {
+	tests := []struct {
+		line  string
+		level slog.Level
+		msg   string
+		attrs [][2]string
+	}{
+		{`time=2023-06-01T10:00:00.000+08:00 level=WARN msg="discard checkpoint" file=/tmp/a.log reason="file not exist"`,
+			slog.LevelWarn, "discard checkpoint", [][2]string{{"file", "/tmp/a.log"}, {"reason", "file not exist"}}},
+		{`{"time":"2023-06-01T10:00:00.000+08:00","level":"ERROR","msg":"send error","topic":"nginx","offset":12}`,
+			slog.LevelError, "send error", [][2]string{{"topic", "nginx"}, {"offset", "12"}}},
+		{`2023/06/01 10:00:00 INFO collectors started`, slog.LevelInfo, "collectors started", nil},
+	}
+	for _, tt := range tests {
+		entry := parseLogLine(tt.line)
+		if !entry.Parsed || entry.Time.IsZero() || !entry.HasLevel {
+			t.Fatalf("%s: not parsed: %+v", tt.line, entry)
+		}
+		if entry.Level != tt.level || entry.Msg != tt.msg || !slices.Equal(entry.Attrs, tt.attrs) {
+			t.Errorf("%s: got %v %q %v", tt.line, entry.Level, entry.Msg, entry.Attrs)
+		}
+	}
+
+	if entry := parseLogLine("panic: something"); entry.Parsed {
+		t.Errorf("unexpected parsed %+v", entry)
+	}
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// logEntry 解析后的一行日志，解析失败时只有 Raw
+type logEntry struct {
+	Raw      string
+	Time     time.Time
+	Level    slog.Level
+	HasLevel bool
+	Msg      string
+	Attrs    [][2]string // 保持原来的顺序
+	Parsed   bool
+}
+
+// 标准库 log 的时间格式，slog 接管之前的日志和启动失败时的日志是这种格式
+const stdLogLayout = "2006/01/02 15:04:05"
+
+// parseLogLine 解析 slog 的 json 或者 text 格式，以及标准库 log 的格式
+func parseLogLine(line string) logEntry {
+	entry := logEntry{Raw: line}
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case strings.HasPrefix(trimmed, "{"):
+		parseJSONLine(trimmed, &entry)
+	case strings.HasPrefix(trimmed, "time="):
+		parseTextLine(trimmed, &entry)
+	case len(trimmed) >= len(stdLogLayout):
+		parseStdLine(trimmed, &entry)
+	}
+	return entry
+}
+
+// setField 处理 time、level、msg 三个固定的字段，其他的作为属性
+func (e *logEntry) setField(key, value string) {
+	switch key {
+	case slog.TimeKey:
+		if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			e.Time = t
+			return
+		}
+	case slog.LevelKey:
+		if err := e.Level.UnmarshalText([]byte(value)); err == nil {
+			e.HasLevel = true
+			return
+		}
+	case slog.MessageKey:
+		e.Msg = value
+		return
+	}
+	e.Attrs = append(e.Attrs, [2]string{key, value})
+}
+
+func parseJSONLine(line string, entry *logEntry) {
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return
+	}
+	fields := *entry
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return
+		}
+		key, _ := token.(string)
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return
+		}
+		// 字符串去掉引号，对象和数组保持原样
+		text := string(value)
+		var s string
+		if json.Unmarshal(value, &s) == nil {
+			text = s
+		}
+		fields.setField(key, text)
+	}
+	fields.Parsed = true
+	*entry = fields
+}
+
+// parseTextLine 解析 slog.TextHandler 的 key=value 格式，值可能是带引号的字符串
+func parseTextLine(line string, entry *logEntry) {
+	fields := *entry
+	for rest := line; rest != ""; {
+		rest = strings.TrimLeft(rest, " ")
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return
+		}
+		key, value := rest[:eq], rest[eq+1:]
+		if strings.HasPrefix(value, `"`) {
+			quoted, err := strconv.QuotedPrefix(value)
+			if err != nil {
+				return
+			}
+			rest = value[len(quoted):]
+			value, _ = strconv.Unquote(quoted)
+		} else if i := strings.IndexByte(value, ' '); i >= 0 {
+			value, rest = value[:i], value[i:]
+		} else {
+			rest = ""
+		}
+		fields.setField(key, value)
+	}
+	fields.Parsed = true
+	*entry = fields
+}
+
+// parseStdLine 解析 2006/01/02 15:04:05 [LEVEL] message
+func parseStdLine(line string, entry *logEntry) {
+	t, err := time.ParseInLocation(stdLogLayout, line[:len(stdLogLayout)], time.Local)
+	if err != nil {
+		return
+	}
+	entry.Time, entry.Parsed = t, true
+	entry.Msg = strings.TrimSpace(line[len(stdLogLayout):])
+	level, msg, _ := strings.Cut(entry.Msg, " ")
+	switch level {
+	case "DEBUG", "INFO", "WARN", "ERROR":
+		entry.Level.UnmarshalText([]byte(level))
+		entry.HasLevel, entry.Msg = true, msg
+	}
+}
+
+var (
+	logTimeStyle  = lipgloss.NewStyle().Faint(true)
+	logMsgStyle   = lipgloss.NewStyle().Bold(true)
+	logKeyStyle   = lipgloss.NewStyle().Faint(true)
+	logLevelStyle = map[slog.Level]lipgloss.Style{
+		slog.LevelDebug: lipgloss.NewStyle().Foreground(lipgloss.Color("63")),
+		slog.LevelInfo:  lipgloss.NewStyle().Foreground(lipgloss.Color("86")),
+		slog.LevelWarn:  lipgloss.NewStyle().Foreground(lipgloss.Color("192")),
+		slog.LevelError: lipgloss.NewStyle().Foreground(lipgloss.Color("204")).Bold(true),
+	}
+)
+
+// prettyLogLine 按照 时间 级别 消息 属性 的顺序展示，没有解析出来的行原样输出
+func prettyLogLine(entry logEntry) string {
+	if !entry.Parsed {
+		return entry.Raw
+	}
+	var b bytes.Buffer
+	if !entry.Time.IsZero() {
+		b.WriteString(logTimeStyle.Render(entry.Time.Local().Format("2006-01-02 15:04:05.000")) + " ")
+	}
+	if entry.HasLevel {
+		level := fmt.Sprintf("%-5s", entry.Level.String())
+		style, ok := logLevelStyle[entry.Level]
+		if !ok {
+			style = logLevelStyle[slog.LevelError]
+		}
+		b.WriteString(style.Render(level) + " ")
+	}
+	b.WriteString(logMsgStyle.Render(entry.Msg))
+	for _, attr := range entry.Attrs {
+		value := attr[1]
+		if value == "" || strings.ContainsAny(value, " \"=") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(" " + logKeyStyle.Render(attr[0]+"=") + value)
+	}
+	return b.String()
+}
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/y7ut/logagent/agent"
+	"github.com/y7ut/logagent/component/table"
+	"github.com/y7ut/logagent/conf"
+	"gopkg.in/ini.v1"
+)
+
+var OffsetsCommand = &cobra.Command{
+	Use:          "offsets",
+	Short:        "Inspect and edit offsets of collected files",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listOffsets(cmd, args)
+	},
+}
+
+var listOffsetsCommand = &cobra.Command{
+	Use:          "list",
+	Short:        "List offsets of all tracked files",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listOffsets(cmd, args)
+	},
+}
+
+var setOffsetCommand = &cobra.Command{
+	Use:   "set <path> <offset|end>",
+	Short: "Set the offset of a file, the collector starts from it next time",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setOffset(cmd, args)
+	},
+}
+
+var resetOffsetCommand = &cobra.Command{
+	Use:   "reset <path>",
+	Short: "Remove the offset of a file, the collector starts from the beginning next time",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return resetOffset(cmd, args)
+	},
+}
+
+var gcOffsetCommand = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove offsets of files which no longer exist",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return gcOffsets(cmd, args)
+	},
+}
+
+// offsetRow offsets 列表中的一行
+type offsetRow struct {
+	Path    string `json:"path" yaml:"path" gird_column:"路径" gird_sort:"1"`
+	Offset  int64  `json:"offset" yaml:"offset" gird_column:"偏移" gird_sort:"2"`
+	Size    string `json:"size" yaml:"size" gird_column:"文件大小" gird_sort:"3"`
+	Lag     string `json:"lag" yaml:"lag" gird_column:"未读字节" gird_sort:"4"`
+	ModTime string `json:"mod_time" yaml:"mod_time" gird_column:"修改时间" gird_sort:"5"`
+	Updated string `json:"updated" yaml:"updated" gird_column:"记录时间" gird_sort:"6"`
+}
+
+// loadRuntimePath 从配置文件中读取运行目录
+func loadRuntimePath(cmd *cobra.Command) (string, error) {
+	configPath := cmd.Flag("config").Value.String()
+	checkconfig(configPath)
+
+	if err := ini.MapTo(conf.APPConfig, configPath); err != nil {
+		return "", fmt.Errorf("load ini file error: %s", err)
+	}
+	return conf.APPConfig.Runtime.Path, nil
+}
+
+func listOffsets(cmd *cobra.Command, args []string) error {
+	format, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	runtimePath, err := loadRuntimePath(cmd)
+	if err != nil {
+		return err
+	}
+
+	entries, err := agent.ListOffsets(runtimePath)
+	if err != nil {
+		return fmt.Errorf("list offsets error: %w", err)
+	}
+
+	// 已经按照路径排好序了
+	data := make([]offsetRow, 0, len(entries))
+	for _, entry := range entries {
+		row := offsetRow{Path: entry.Source, Offset: entry.Offset, Size: "-", Lag: "-", ModTime: "-", Updated: "-"}
+		if !entry.UpdatedAt.IsZero() {
+			row.Updated = entry.UpdatedAt.Format(time.DateTime)
+		}
+		if entry.IsBackfill() {
+			if entry.Offset == -1 {
+				row.Lag = "done"
+			}
+			data = append(data, row)
+			continue
+		}
+		if stat, err := os.Stat(entry.Source); err == nil {
+			row.Size = strconv.FormatInt(stat.Size(), 10)
+			row.Lag = fileLag(stat.Size(), entry.Offset)
+			row.ModTime = stat.ModTime().Format(time.DateTime)
+		} else {
+			row.Lag = "missing"
+		}
+		data = append(data, row)
+	}
+
+	if err := printGrid(format, data, table.NewGrid(data), nil); err != nil {
+		return fmt.Errorf("error running program: %w", err)
+	}
+	return nil
+}
+
+// fileLag 未读的字节数，文件比 offset 小说明被截断或者轮转了，收集器下次会从头读取
+func fileLag(size, offset int64) string {
+	if size < offset {
+		return "truncated"
+	}
+	return strconv.FormatInt(size-offset, 10)
+}
+
+func setOffset(cmd *cobra.Command, args []string) error {
+	runtimePath, err := loadRuntimePath(cmd)
+	if err != nil {
+		return err
+	}
+
+	path := args[0]
+	var offset int64
+	if args[1] == "end" {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		offset = stat.Size()
+	} else {
+		offset, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil || offset < 0 {
+			return fmt.Errorf("offset(%s) format error", args[1])
+		}
+	}
+
+	if err := agent.SetOffset(runtimePath, path, offset); err != nil {
+		return err
+	}
+	fmt.Printf("set offset of %s to %d\n", path, offset)
+	return nil
+}
+
+func resetOffset(cmd *cobra.Command, args []string) error {
+	runtimePath, err := loadRuntimePath(cmd)
+	if err != nil {
+		return err
+	}
+
+	if err := agent.ResetOffset(runtimePath, args[0]); err != nil {
+		return err
+	}
+	fmt.Printf("reset offset of %s\n", args[0])
+	return nil
+}
+
+func gcOffsets(cmd *cobra.Command, args []string) error {
+	runtimePath, err := loadRuntimePath(cmd)
+	if err != nil {
+		return err
+	}
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	entries, err := agent.ListOffsets(runtimePath)
+	if err != nil {
+		return err
+	}
+
+	missing := make([]string, 0)
+	for _, entry := range entries {
+		// 回填记录保证归档不会被重复发送，需要手动 reset
+		if entry.IsBackfill() {
+			continue
+		}
+		if _, err := os.Stat(entry.Source); err == nil || !os.IsNotExist(err) {
+			continue
+		}
+		missing = append(missing, entry.Source)
+		if dryRun {
+			fmt.Printf("would remove %s\n", entry.Source)
+		}
+	}
+	if !dryRun && len(missing) > 0 {
+		if err := agent.ResetOffsets(runtimePath, missing); err != nil {
+			return err
+		}
+		for _, path := range missing {
+			fmt.Printf("removed %s\n", path)
+		}
+	}
+	fmt.Printf("total %d offsets of missing files\n", len(missing))
+	return nil
+}
+
+func init() {
+	OffsetsCommand.PersistentFlags().StringP("config", "c", "./bifrost.conf", "config bifrost file")
+	for _, c := range []*cobra.Command{OffsetsCommand, listOffsetsCommand} {
+		c.Flags().StringP("output", "o", OutputTable, "output format: table, json, yaml, csv or plain, plain when stdout is not a terminal")
+	}
+	gcOffsetCommand.Flags().Bool("dry-run", false, "only print offsets to remove")
+	OffsetsCommand.AddCommand(listOffsetsCommand, setOffsetCommand, resetOffsetCommand, gcOffsetCommand)
+	RootCmd.AddCommand(OffsetsCommand)
+}
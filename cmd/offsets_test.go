@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileLag(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int64
+		offset int64
+		want   string
+	}{
+		{"read to the end", 10, 10, "0"},
+		{"unread bytes", 10, 4, "6"},
+		{"truncated", 4, 10, "truncated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fileLag(tt.size, tt.offset); got != tt.want {
+				t.Errorf("fileLag(%d, %d) = %q, want %q", tt.size, tt.offset, got, tt.want)
+			}
+		})
+	}
+}
+
+// 各种失败都要通过 RunE 返回，让进程以非零状态退出
+func TestListOffsetsErrors(t *testing.T) {
+	dir := t.TempDir()
+	badConfig := filepath.Join(dir, "bad.conf")
+	if err := os.WriteFile(badConfig, []byte("[runtime\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"unknown output", []string{"offsets", "list", "-o", "xml"}},
+		{"broken config", []string{"offsets", "list", "-o", "json", "-c", badConfig}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			RootCmd.SetArgs(tt.args)
+			if err := RootCmd.Execute(); err == nil {
+				t.Errorf("bifrost %v succeeded, want an error", tt.args)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+	"github.com/y7ut/logagent/component/table"
+	"gopkg.in/yaml.v3"
+)
+
+// 列表命令支持的输出格式
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+	OutputCSV   = "csv"
+	OutputPlain = "plain"
+)
+
+// outputFormat 读取 --output，标准输出不是终端时表格没法交互，改成 plain
+func outputFormat(cmd *cobra.Command) (string, error) {
+	format, _ := cmd.Flags().GetString("output")
+	switch format {
+	case OutputTable:
+		if !isatty.IsTerminal(os.Stdout.Fd()) && !isatty.IsCygwinTerminal(os.Stdout.Fd()) {
+			return OutputPlain, nil
+		}
+	case OutputJSON, OutputYAML, OutputCSV, OutputPlain:
+	default:
+		return "", fmt.Errorf("output(%s) must be one of table, json, yaml, csv, plain", format)
+	}
+	return format, nil
+}
+
+// printGrid 按照格式输出，json 和 yaml 使用 items 本身的字段，csv 和 plain 和表格一样使用翻译后的列
+// detail 不为 nil 时，交互表格中按 enter 可以查看详情
+func printGrid[T any](format string, items []T, grid *table.ObjectGrid[T], detail table.DetailFunc) error {
+	switch format {
+	case OutputJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(items)
+	case OutputYAML:
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(items); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case OutputCSV:
+		return grid.Export(os.Stdout, table.ExportCSV)
+	case OutputPlain:
+		return grid.Export(os.Stdout, table.ExportPlain)
+	default:
+		_, err := tea.NewProgram(table.Create(grid).WithDetail(detail)).Run()
+		return err
+	}
+}
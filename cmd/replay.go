@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/y7ut/logagent/agent"
+	"github.com/y7ut/logagent/conf"
+	"github.com/y7ut/logagent/etcd"
+	"gopkg.in/ini.v1"
+)
+
+var ReplayCommand = &cobra.Command{
+	Use:   "replay",
+	Short: "Re-send a range of a log file to Kafka",
+	Long: `Re-send a range of a log file to Kafka through the same processing as run.
+The range can be byte offsets, line numbers or timestamps, offsets of the daemon are not touched.
+
+  ./bifrost replay --collector /var/log/app.log --by line --start 100 --end 200
+  ./bifrost replay --file /var/log/app.log.1.gz --topic app_log --by time --start "2023-06-01 10:00:00"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		replay(cmd, args)
+	},
+}
+
+func replay(cmd *cobra.Command, args []string) {
+	configPath := cmd.Flag("config").Value.String()
+	checkconfig(configPath)
+
+	if err := ini.MapTo(conf.APPConfig, configPath); err != nil {
+		fmt.Printf("load ini file error: %s ", err)
+		return
+	}
+
+	collectorPath, _ := cmd.Flags().GetString("collector")
+	fileName, _ := cmd.Flags().GetString("file")
+	topic, _ := cmd.Flags().GetString("topic")
+
+	var collector agent.Collector
+	switch {
+	case collectorPath != "":
+		found, err := findCollector(collectorPath)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		collector = found
+		if fileName == "" {
+			fileName = collector.Path
+			if collector.Style == "Date" {
+				fileName = time.Now().Format(collector.Path)
+			}
+		}
+		if topic != "" {
+			collector.Topic = topic
+		}
+	case fileName != "" && topic != "":
+		collector = agent.Collector{Style: "File", Path: fileName, Topic: topic}
+	default:
+		fmt.Println("either --collector or both --file and --topic are required")
+		os.Exit(1)
+	}
+
+	// 默认使用收集器的限速，避免重放挤占线上的 Kafka，指定了 --rate 时替换掉收集器的限速
+	if cmd.Flags().Changed("rate") {
+		collector.RateLines, _ = cmd.Flags().GetInt("rate")
+		collector.BurstLines, collector.RateBytes, collector.BurstBytes = 0, 0, 0
+	}
+
+	r, err := parseReplayRange(cmd)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// 第一次中断时停止读取，等待缓冲中的消息写完，第二次中断直接退出
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		stopping := false
+		for s := range sign() {
+			switch s {
+			case syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM:
+				if stopping {
+					fmt.Println("replay aborted, buffered messages are lost")
+					os.Exit(1)
+				}
+				stopping = true
+				fmt.Println("stopping, waiting for buffered messages, interrupt again to abort")
+				cancel()
+			}
+		}
+	}()
+
+	fmt.Printf("replay %s to topic %s by %s...\n", fileName, collector.Topic, r.By)
+	result, err := agent.Replay(ctx, collector, fileName, r)
+	if result.Undelivered > 0 {
+		fmt.Printf("%d messages were not delivered to kafka and went to the dead letter\n", result.Undelivered)
+	}
+	if err != nil {
+		fmt.Printf("replay stopped after %d lines: %s\n", result.Lines, err)
+		os.Exit(1)
+	}
+	if result.Undelivered > 0 {
+		os.Exit(1)
+	}
+	fmt.Printf("🎏 replay %d lines finished\n", result.Lines)
+}
+
+// findCollector 在当前节点的收集器配置中找到路径为 path 的收集器
+func findCollector(path string) (agent.Collector, error) {
+	etcd.Init()
+
+	collectorData, _, err := etcd.GetCollectorConf(conf.APPConfig.ID)
+	if err != nil {
+		return agent.Collector{}, fmt.Errorf("get etcd conf error: %s", err)
+	}
+
+	collectors := make([]agent.Collector, 0)
+	if err := json.Unmarshal(collectorData, &collectors); err != nil {
+		return agent.Collector{}, fmt.Errorf("unmarshal error: %s", err)
+	}
+	for _, collector := range collectors {
+		if collector.Path == path {
+			return collector, nil
+		}
+	}
+	return agent.Collector{}, fmt.Errorf("collector %s not found in agent %s", path, conf.APPConfig.ID)
+}
+
+// parseReplayRange 根据 --by 解析 --start 和 --end
+func parseReplayRange(cmd *cobra.Command) (agent.ReplayRange, error) {
+	by, _ := cmd.Flags().GetString("by")
+	start, _ := cmd.Flags().GetString("start")
+	end, _ := cmd.Flags().GetString("end")
+	layout, _ := cmd.Flags().GetString("time-layout")
+
+	r := agent.ReplayRange{By: by, TimeLayout: layout}
+	var err error
+	switch by {
+	case agent.ReplayByOffset, agent.ReplayByLine:
+		if start != "" {
+			if r.Start, err = strconv.ParseInt(start, 10, 64); err != nil {
+				return r, fmt.Errorf("start(%s) format error: %s", start, err)
+			}
+		}
+		if end != "" {
+			if r.End, err = strconv.ParseInt(end, 10, 64); err != nil {
+				return r, fmt.Errorf("end(%s) format error: %s", end, err)
+			}
+		}
+	case agent.ReplayByTime:
+		if start != "" {
+			if r.Since, err = time.ParseInLocation(layout, start, time.Local); err != nil {
+				return r, fmt.Errorf("start(%s) format error: %s", start, err)
+			}
+		}
+		if end != "" {
+			if r.Until, err = time.ParseInLocation(layout, end, time.Local); err != nil {
+				return r, fmt.Errorf("end(%s) format error: %s", end, err)
+			}
+		}
+	default:
+		return r, fmt.Errorf("by(%s) must be one of offset, line, time", by)
+	}
+	return r, nil
+}
+
+func init() {
+	ReplayCommand.Flags().StringP("config", "c", "./bifrost.conf", "config bifrost file")
+	ReplayCommand.Flags().String("collector", "", "path of the collector in etcd config")
+	ReplayCommand.Flags().StringP("file", "f", "", "file to replay, defaults to the path of the collector")
+	ReplayCommand.Flags().StringP("topic", "t", "", "topic to send, defaults to the topic of the collector")
+	ReplayCommand.Flags().String("by", agent.ReplayByOffset, "unit of start and end: offset, line or time")
+	ReplayCommand.Flags().String("start", "", "start of the range")
+	ReplayCommand.Flags().String("end", "", "end of the range, defaults to the end of file")
+	ReplayCommand.Flags().Int("rate", 0, "max lines per second instead of the rate limits of the collector, 0 for no limit")
+	ReplayCommand.Flags().String("time-layout", "2006-01-02 15:04:05", "layout of the timestamp at the beginning of each line")
+	RootCmd.AddCommand(ReplayCommand)
+}
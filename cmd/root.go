@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+	"github.com/y7ut/logagent/component/table"
 )
 
 var (
@@ -22,6 +23,10 @@ var RootCmd = &cobra.Command{
   / /_/ / / __/ /  / /_/ (__  ) /_
  /_____/_/_/ /_/   \____/____/\__/
 `,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		theme, _ := cmd.Flags().GetString("theme")
+		return table.SetTheme(theme)
+	},
 }
 
 func Execute() {
@@ -30,3 +35,7 @@ func Execute() {
 		os.Exit(1)
 	}
 }
+
+func init() {
+	RootCmd.PersistentFlags().String("theme", "", "color theme of tables: dark, light or none, defaults to none when NO_COLOR is set")
+}
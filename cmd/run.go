@@ -46,11 +46,17 @@ func run(cmd *cobra.Command, args []string) {
 	}
 	fmt.Printf("use config file[%s] start... \n", configPath)
 
-	agent.Init(conf.APPConfig.Runtime.Path, conf.APPConfig.Log.Path, conf.APPConfig.Log.Name)
+	// --log-level 优先于配置文件
+	if level := cmd.Flag("log-level").Value.String(); level != "" {
+		conf.APPConfig.Log.Level = level
+	}
+
+	agent.Init(conf.APPConfig.Runtime.Path, conf.APPConfig.Log)
 	agent.Start()
 }
 
 func init() {
 	RunCommand.Flags().StringP("config", "c", "./bifrost.conf", "config bifrost file")
+	RunCommand.Flags().String("log-level", "", "log level: debug, info, warn or error, overrides [log] level")
 	RootCmd.AddCommand(RunCommand)
 }
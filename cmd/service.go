@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/y7ut/logagent/agent"
+)
+
+const (
+	defaultServiceName = "bifrost"
+	defaultUnitDir     = "/etc/systemd/system"
+	// 按照 100 个收集器估算 TimeoutStopSec，收集器更多时用 --stop-timeout 调大
+	estimatedCollectors = 100
+)
+
+var ServiceCommand = &cobra.Command{
+	Use:   "service",
+	Short: "Install or uninstall bifrost as a systemd service",
+	Long: `Install or uninstall bifrost as a systemd service. The service runs "bifrost run" in the
+foreground and reports its state with sd_notify, use systemctl instead of start/stop/restart.`,
+}
+
+var installServiceCommand = &cobra.Command{
+	Use:          "install",
+	Short:        "Generate a systemd unit from the config and enable it",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return installService(cmd, args)
+	},
+}
+
+var uninstallServiceCommand = &cobra.Command{
+	Use:          "uninstall",
+	Short:        "Stop, disable and remove the systemd unit",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return uninstallService(cmd, args)
+	},
+}
+
+// serviceUnit 生成 unit 文件用到的参数
+type serviceUnit struct {
+	Exec     string
+	Config   string
+	WorkDir  string
+	User     string
+	Watchdog time.Duration
+	Stop     time.Duration // TimeoutStopSec，要大于 bifrost 退出最长需要的时间
+}
+
+var unitTemplate = template.Must(template.New("unit").Funcs(template.FuncMap{
+	"quote":   quoteUnitArg,
+	"seconds": func(d time.Duration) int64 { return int64(d.Round(time.Second) / time.Second) },
+}).Parse(`[Unit]
+Description=Bifrost log agent
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=notify
+NotifyAccess=main
+User={{.User}}
+WorkingDirectory={{quote .WorkDir}}
+ExecStart={{quote .Exec}} run --config {{quote .Config}}
+Restart=on-failure
+RestartSec=5
+TimeoutStopSec={{seconds .Stop}}
+{{- if .Watchdog}}
+WatchdogSec={{seconds .Watchdog}}
+{{- end}}
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+// quoteUnitArg 有空格等字符时按照 systemd 的规则加上引号
+func quoteUnitArg(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+// renderUnit 根据当前的可执行文件、配置文件和用户生成 unit
+func renderUnit(cmd *cobra.Command) ([]byte, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	if executable, err = filepath.EvalSymlinks(executable); err != nil {
+		return nil, err
+	}
+
+	configPath, err := filepath.Abs(cmd.Flag("config").Value.String())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(configPath); err != nil {
+		return nil, fmt.Errorf("config %s: %w", configPath, err)
+	}
+
+	unit := serviceUnit{Exec: executable, Config: configPath, WorkDir: filepath.Dir(configPath)}
+	unit.User, _ = cmd.Flags().GetString("user")
+	if unit.User == "" {
+		current, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+		unit.User = current.Username
+	}
+	unit.Watchdog, _ = cmd.Flags().GetDuration("watchdog")
+	unit.Stop, _ = cmd.Flags().GetDuration("stop-timeout")
+
+	var b bytes.Buffer
+	if err := unitTemplate.Execute(&b, unit); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// unitPath unit 文件的路径
+func unitPath(cmd *cobra.Command) string {
+	name, _ := cmd.Flags().GetString("name")
+	dir, _ := cmd.Flags().GetString("unit-dir")
+	return filepath.Join(dir, name+".service")
+}
+
+func systemctl(args ...string) error {
+	c := exec.Command("systemctl", args...)
+	c.Stdout, c.Stderr = os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("systemctl %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+func installService(cmd *cobra.Command, args []string) error {
+	unit, err := renderUnit(cmd)
+	if err != nil {
+		return err
+	}
+	if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+		fmt.Print(string(unit))
+		return nil
+	}
+
+	// 用 start 启动的后台进程会和 systemd 抢同一份检查点
+	if pid, err := daemonStart(); err == nil && pid != -1 {
+		return fmt.Errorf("bifrost is running in pid[%d] started by `./bifrost start`, stop it first", pid)
+	}
+
+	path := unitPath(cmd)
+	if err := os.WriteFile(path, unit, 0644); err != nil {
+		return err
+	}
+	fmt.Println("unit saved to", path)
+
+	name, _ := cmd.Flags().GetString("name")
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	enable := []string{"enable", name}
+	if now, _ := cmd.Flags().GetBool("now"); now {
+		enable = []string{"enable", "--now", name}
+	}
+	if err := systemctl(enable...); err != nil {
+		return err
+	}
+	fmt.Printf("🎏 bifrost installed, use `systemctl status %s` to check it\n", name)
+	return nil
+}
+
+func uninstallService(cmd *cobra.Command, args []string) error {
+	path := unitPath(cmd)
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("unit %s: %w", path, err)
+	}
+
+	name, _ := cmd.Flags().GetString("name")
+	if err := systemctl("disable", "--now", name); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	fmt.Println("🤚 bifrost uninstalled")
+	return nil
+}
+
+func init() {
+	ServiceCommand.PersistentFlags().String("name", defaultServiceName, "name of the systemd unit")
+	ServiceCommand.PersistentFlags().String("unit-dir", defaultUnitDir, "directory of the systemd unit")
+
+	installServiceCommand.Flags().StringP("config", "c", "./bifrost.conf", "config bifrost file")
+	installServiceCommand.Flags().String("user", "", "user to run bifrost, defaults to the current user")
+	installServiceCommand.Flags().Duration("watchdog", time.Minute, "restart bifrost when it hangs for this long, 0 to disable")
+	installServiceCommand.Flags().Duration("stop-timeout", agent.StopTimeout(estimatedCollectors),
+		"TimeoutStopSec of the unit, bifrost waits 500ms for each collector and up to 10s for kafka when it stops")
+	installServiceCommand.Flags().Bool("now", false, "start the service after installing")
+	installServiceCommand.Flags().Bool("dry-run", false, "only print the unit")
+
+	ServiceCommand.AddCommand(installServiceCommand, uninstallServiceCommand)
+	RootCmd.AddCommand(ServiceCommand)
+}
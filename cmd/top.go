@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+	"github.com/y7ut/logagent/agent"
+	"github.com/y7ut/logagent/component/table"
+	"github.com/y7ut/logagent/conf"
+	"github.com/y7ut/logagent/pkg/collection"
+	"gopkg.in/ini.v1"
+)
+
+var TopCommand = &cobra.Command{
+	Use:   "top",
+	Short: "Live dashboard of collectors of the running bifrost",
+	Long: `Live dashboard of collectors of the running bifrost, it reads the metrics server
+configured in [metrics] address. Press enter on a collector to stream its recent lines.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		top(cmd, args)
+	},
+}
+
+// topRow top 中的一行
+type topRow struct {
+	Path        string    `gird_column:"路径" gird_sort:"1"`
+	Topic       string    `gird_column:"日志主题" gird_sort:"2"`
+	LinesPerSec float64   `gird_column:"行/秒" gird_sort:"3"`
+	BytesPerSec float64   `gird_column:"字节/秒" gird_sort:"4" gird_format:"bytes"`
+	Lag         int64     `gird_column:"未读" gird_sort:"5" gird_format:"bytes"`
+	Errors      int64     `gird_column:"失败" gird_sort:"6"`
+	Dropped     int64     `gird_column:"丢弃" gird_sort:"7"`
+	LastLine    time.Time `gird_column:"最后一行" gird_sort:"8" gird_format:"duration"`
+}
+
+// daemonClient 通过指标服务读取运行中的 bifrost
+type daemonClient struct {
+	base   string
+	client *http.Client
+}
+
+func newDaemonClient(address string) *daemonClient {
+	// 只配置了端口时连接本机
+	if strings.HasPrefix(address, ":") {
+		address = "127.0.0.1" + address
+	}
+	return &daemonClient{base: "http://" + address, client: &http.Client{Timeout: time.Second}}
+}
+
+func (c *daemonClient) get(path string, v any) error {
+	resp, err := c.client.Get(c.base + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// 带上 bifrost 返回的原因
+		reason, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("%s: %s %s", path, resp.Status, bytes.TrimSpace(reason))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// collectors 所有收集器的状态
+func (c *daemonClient) collectors() (map[string]agent.CollectorStatus, error) {
+	var vars struct {
+		Bifrost struct {
+			Collectors map[string]agent.CollectorStatus `json:"collectors"`
+		} `json:"bifrost"`
+	}
+	if err := c.get("/debug/vars", &vars); err != nil {
+		return nil, err
+	}
+	return vars.Bifrost.Collectors, nil
+}
+
+// recentLines 一个收集器最近读到的日志
+func (c *daemonClient) recentLines(path string) ([]string, error) {
+	lines := make([]string, 0)
+	err := c.get("/debug/bifrost/recent?path="+url.QueryEscape(path), &lines)
+	return lines, err
+}
+
+func top(cmd *cobra.Command, args []string) {
+	configPath := cmd.Flag("config").Value.String()
+	checkconfig(configPath)
+
+	if err := ini.MapTo(conf.APPConfig, configPath); err != nil {
+		fmt.Printf("load ini file error: %s ", err)
+		return
+	}
+	address, _ := cmd.Flags().GetString("address")
+	if address == "" {
+		address = conf.APPConfig.Metrics.Address
+	}
+	if address == "" {
+		fmt.Println("top reads the metrics server, set [metrics] address in config or use --address")
+		os.Exit(1)
+	}
+	interval, _ := cmd.Flags().GetDuration("interval")
+
+	client := newDaemonClient(address)
+
+	// 和上一次的数据比较计算速率
+	var last map[string]agent.CollectorStatus
+	var lastTime time.Time
+	refresh := func() (table.Grid, error) {
+		current, err := client.collectors()
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		elapsed := now.Sub(lastTime).Seconds()
+
+		rows := make([]topRow, 0, len(current))
+		for path, st := range current {
+			row := topRow{Path: path, Topic: st.Topic, Lag: st.Lag, Errors: st.Errors, Dropped: st.Dropped, LastLine: st.LastLine}
+			if prev, ok := last[path]; ok && elapsed > 0 {
+				row.LinesPerSec = rate(st.Lines-prev.Lines, elapsed)
+				row.BytesPerSec = rate(st.Bytes-prev.Bytes, elapsed)
+			}
+			rows = append(rows, row)
+		}
+		last, lastTime = current, now
+
+		rows = collection.New(rows).Sort(func(i, j topRow) bool {
+			return i.Path < j.Path
+		}).Value()
+		return table.NewGrid(rows), nil
+	}
+	detail := func(row []string) ([]string, error) {
+		return client.recentLines(row[0])
+	}
+
+	dashboard, err := table.NewDashboard(interval, refresh, detail)
+	if err != nil {
+		fmt.Printf("connect to bifrost at %s error: %s\n", address, err)
+		os.Exit(1)
+	}
+	if _, err := tea.NewProgram(dashboard).Run(); err != nil {
+		fmt.Println("Error running program:", err)
+		os.Exit(1)
+	}
+}
+
+// rate 每秒的速率，保留一位小数，计数变小(bifrost 重启)时为0
+func rate(delta int64, seconds float64) float64 {
+	if delta < 0 {
+		return 0
+	}
+	return math.Round(float64(delta)/seconds*10) / 10
+}
+
+func init() {
+	TopCommand.Flags().StringP("config", "c", "./bifrost.conf", "config bifrost file")
+	TopCommand.Flags().String("address", "", "address of the metrics server, defaults to [metrics] address")
+	TopCommand.Flags().Duration("interval", time.Second, "refresh interval")
+	RootCmd.AddCommand(TopCommand)
+}
@@ -0,0 +1,149 @@
+package table
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// RefreshFunc 重新获取表格的数据
+type RefreshFunc func() (Grid, error)
+
+// DetailFunc 获取选中行的详情，每次刷新时都会重新获取
+type DetailFunc func(row []string) ([]string, error)
+
+// 详情面板最多展示的行数
+const detailLines = 10
+
+type tickMsg time.Time
+
+// Dashboard 定时刷新的表格，选中一行后在下方展示它的详情
+type Dashboard struct {
+	table    HermersTable
+	refresh  RefreshFunc
+	detail   DetailFunc
+	interval time.Duration
+	err      error
+	updated  time.Time
+
+	selected table.Row // 正在查看详情的行，为 nil 时不展示详情
+	lines    []string
+
+	width, height int // 终端的大小
+}
+
+// NewDashboard 创建一个每隔 interval 刷新一次的表格，detail 为 nil 时不支持查看详情
+func NewDashboard(interval time.Duration, refresh RefreshFunc, detail DetailFunc) (Dashboard, error) {
+	data, err := refresh()
+	if err != nil {
+		return Dashboard{}, err
+	}
+	return Dashboard{
+		table:    Create(data),
+		refresh:  refresh,
+		detail:   detail,
+		interval: interval,
+		updated:  time.Now(),
+	}, nil
+}
+
+func (d Dashboard) tick() tea.Cmd {
+	return tea.Tick(d.interval, func(t time.Time) tea.Msg { return tickMsg(t) })
+}
+
+func (d Dashboard) Init() tea.Cmd { return d.tick() }
+
+func (d Dashboard) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tickMsg:
+		d.reload()
+		return d, d.tick()
+	case tea.WindowSizeMsg:
+		d.width, d.height = msg.Width, msg.Height
+		d.resize()
+		return d, nil
+	case tea.KeyMsg:
+		if d.table.mode == modeNormal {
+			switch {
+			case key.Matches(msg, d.table.keyMap.Enter):
+				if d.detail != nil {
+					d.selected = d.table.table.SelectedRow()
+					d.loadDetail()
+					// 详情面板占用了表格的高度
+					d.resize()
+				}
+				return d, nil
+			case key.Matches(msg, d.table.keyMap.Focus) && d.selected != nil:
+				// 先关闭详情，再按一次才是锁定表格
+				d.selected, d.lines = nil, nil
+				d.resize()
+				return d, nil
+			}
+		}
+	}
+
+	model, cmd := d.table.Update(msg)
+	d.table = model.(HermersTable)
+	return d, cmd
+}
+
+// reload 重新获取数据，保留当前的条件和光标
+func (d *Dashboard) reload() {
+	data, err := d.refresh()
+	d.err = err
+	if err != nil {
+		return
+	}
+	d.table.SetData(data)
+	d.updated = time.Now()
+	d.loadDetail()
+}
+
+// resize 表格的高度减去顶部的状态和详情面板
+func (d *Dashboard) resize() {
+	if d.height == 0 {
+		return
+	}
+	height := d.height - 1
+	if d.selected != nil {
+		// 边框 2 行，标题 1 行
+		height -= detailLines + 3
+	}
+	d.table.resize(d.width, height)
+}
+
+func (d *Dashboard) loadDetail() {
+	if d.selected == nil {
+		return
+	}
+	lines, err := d.detail(d.selected)
+	if err != nil {
+		lines = []string{fmt.Sprintf("error: %s", err)}
+	}
+	if len(lines) > detailLines {
+		lines = lines[len(lines)-detailLines:]
+	}
+	d.lines = lines
+}
+
+func (d Dashboard) View() string {
+	status := fmt.Sprintf("每 %s 刷新，最后刷新于 %s", d.interval, d.updated.Format(time.TimeOnly))
+	if d.err != nil {
+		status += fmt.Sprintf(" | 刷新失败: %s", d.err)
+	}
+	view := status + "\n" + d.table.View()
+	if d.selected != nil && len(d.selected) > 0 {
+		title := lipgloss.NewStyle().Bold(true).Render(d.selected[0])
+		body := strings.Join(d.lines, "\n")
+		if body == "" {
+			body = "(暂无数据)"
+		}
+		view += detailStyle.Render(title+"\n"+body) + "\n"
+	}
+	return view
+}
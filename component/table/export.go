@@ -0,0 +1,153 @@
+package table
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// 导出的格式
+const (
+	ExportCSV      = "csv"
+	ExportJSON     = "json"
+	ExportMarkdown = "markdown"
+	ExportPlain    = "plain" // 按照显示宽度对齐的纯文本
+)
+
+// ExportFormatOf 根据文件的扩展名判断导出的格式，不认识的扩展名导出纯文本
+func ExportFormatOf(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return ExportCSV
+	case ".json":
+		return ExportJSON
+	case ".md", ".markdown":
+		return ExportMarkdown
+	default:
+		return ExportPlain
+	}
+}
+
+// export 导出渲染后的表格，和界面上一样使用翻译后的表头、列的顺序以及当前的条件
+func export(w io.Writer, format string, columns []table.Column, rows []table.Row) error {
+	headers := make([]string, 0, len(columns))
+	for _, column := range columns {
+		headers = append(headers, column.Title)
+	}
+
+	switch format {
+	case ExportCSV:
+		writer := csv.NewWriter(w)
+		writer.Write(headers)
+		for _, row := range rows {
+			writer.Write(row)
+		}
+		writer.Flush()
+		return writer.Error()
+	case ExportJSON:
+		return exportJSON(w, headers, rows)
+	case ExportMarkdown:
+		escape := strings.NewReplacer("|", "\\|", "\n", " ")
+		line := func(cells []string) string {
+			escaped := make([]string, 0, len(cells))
+			for _, cell := range cells {
+				escaped = append(escaped, escape.Replace(cell))
+			}
+			return "| " + strings.Join(escaped, " | ") + " |\n"
+		}
+		separator := make([]string, len(headers))
+		for i := range separator {
+			separator[i] = "---"
+		}
+		if _, err := io.WriteString(w, line(headers)+line(separator)); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if _, err := io.WriteString(w, line(row)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case ExportPlain:
+		return exportPlain(w, headers, rows)
+	default:
+		return fmt.Errorf("export format(%s) must be one of csv, json, markdown, plain", format)
+	}
+}
+
+// exportJSON 每行导出成一个对象，对象中的字段保持列的顺序
+func exportJSON(w io.Writer, headers []string, rows []table.Row) error {
+	var b strings.Builder
+	b.WriteString("[")
+	for i, row := range rows {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n  {")
+		for k, header := range headers {
+			if k > 0 {
+				b.WriteString(", ")
+			}
+			var value string
+			if k < len(row) {
+				value = row[k]
+			}
+			key, _ := json.Marshal(header)
+			item, _ := json.Marshal(value)
+			b.Write(key)
+			b.WriteString(": ")
+			b.Write(item)
+		}
+		b.WriteString("}")
+	}
+	if len(rows) > 0 {
+		b.WriteString("\n")
+	}
+	b.WriteString("]\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// exportPlain 按照终端中的显示宽度对齐，中文占两个宽度
+func exportPlain(w io.Writer, headers []string, rows []table.Row) error {
+	widths := make([]int, len(headers))
+	for i, header := range headers {
+		widths[i] = lipgloss.Width(header)
+	}
+	for _, row := range rows {
+		for i := 0; i < len(row) && i < len(widths); i++ {
+			if width := lipgloss.Width(row[i]); width > widths[i] {
+				widths[i] = width
+			}
+		}
+	}
+
+	line := func(cells []string) string {
+		var b strings.Builder
+		for i, cell := range cells {
+			if i >= len(widths) {
+				break
+			}
+			b.WriteString(cell)
+			if i < len(widths)-1 {
+				b.WriteString(strings.Repeat(" ", widths[i]-lipgloss.Width(cell)+2))
+			}
+		}
+		return strings.TrimRight(b.String(), " ") + "\n"
+	}
+	if _, err := io.WriteString(w, line(headers)); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if _, err := io.WriteString(w, line(row)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package table
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// gird_format 支持的格式
+const (
+	FormatBytes    = "bytes"    // 整数按照 B KiB MiB 展示
+	FormatDuration = "duration" // time.Duration，数字为秒数，time.Time 为距离现在的时间
+	FormatTime     = "time"     // time.Time 的默认格式 2006-01-02 15:04:05，也可以写成 time:15:04:05 指定格式
+	FormatPercent  = "percent"  // 小数按照百分比展示，0.5 为 50.0%
+)
+
+// 空值，比如 nil 指针或者零值时间
+const emptyCell = "-"
+
+var (
+	stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// gridField 一列对应的字段
+type gridField struct {
+	index  []int  // reflect 的 FieldByIndex，嵌套的字段有多层
+	format string // gird_format
+}
+
+// cell 格式化之后的值，展示格式化的内容，排序时仍然使用原来的值
+type cell struct {
+	value any
+	text  string
+}
+
+func (c cell) String() string { return c.text }
+
+func indirect(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+// isStringer 类型本身或者它的指针实现了 String() 或者 Error()
+func isStringer(t reflect.Type) bool {
+	return implementsString(t) || implementsString(reflect.PtrTo(t))
+}
+
+func implementsString(t reflect.Type) bool {
+	return t.Implements(stringerType) || t.Implements(errorType)
+}
+
+// isNested 需要展开成多列的结构体，自己能转换成字符串的结构体(比如 time.Time)当作一列
+func isNested(t reflect.Type) bool {
+	t = indirect(t)
+	return t.Kind() == reflect.Struct && !isStringer(t)
+}
+
+// displayable 可以展示在一列中的类型
+func displayable(t reflect.Type) bool {
+	if isStringer(t) {
+		return true
+	}
+	t = indirect(t)
+	switch {
+	case t.Kind() <= reflect.Complex128 || t.Kind() == reflect.String:
+		return true
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		// 切片用逗号连接
+		elem := indirect(t.Elem())
+		return isStringer(elem) || elem.Kind() <= reflect.Complex128 || elem.Kind() == reflect.String
+	}
+	return false
+}
+
+// formatValue 按照 gird_format 格式化一个字段，没有格式时数字和字符串保持原样
+func formatValue(v reflect.Value, format string) any {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return emptyCell
+		}
+		// 只有指针实现了 String() 时保留指针
+		if v.Kind() == reflect.Ptr && format == "" && implementsString(v.Type()) && !implementsString(v.Type().Elem()) {
+			break
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return emptyCell
+	}
+
+	raw := v.Interface()
+	if format == "" && v.Type() == timeType {
+		format = FormatTime
+	}
+	name, layout, _ := strings.Cut(format, ":")
+	switch name {
+	case FormatBytes:
+		if n, ok := toFloat(raw); ok {
+			return cell{raw, formatBytes(n)}
+		}
+	case FormatDuration:
+		if t, ok := raw.(time.Time); ok {
+			if t.IsZero() {
+				return cell{raw, emptyCell}
+			}
+			return cell{raw, roundDuration(time.Since(t)).String()}
+		}
+		if d, ok := raw.(time.Duration); ok {
+			return cell{raw, roundDuration(d).String()}
+		}
+		if n, ok := toFloat(raw); ok {
+			return cell{raw, roundDuration(time.Duration(n * float64(time.Second))).String()}
+		}
+	case FormatTime:
+		if t, ok := raw.(time.Time); ok {
+			if t.IsZero() {
+				return cell{raw, emptyCell}
+			}
+			if layout == "" {
+				layout = time.DateTime
+			}
+			return cell{raw, t.Format(layout)}
+		}
+	case FormatPercent:
+		if n, ok := toFloat(raw); ok {
+			return cell{raw, fmt.Sprintf("%.1f%%", n*100)}
+		}
+	}
+
+	switch {
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		items := make([]string, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			items = append(items, fmt.Sprint(formatValue(v.Index(i), "")))
+		}
+		return cell{raw, strings.Join(items, ",")}
+	case v.Kind() <= reflect.Complex128 || v.Kind() == reflect.String:
+		return raw
+	default:
+		// fmt 会调用 String() 或者 Error()
+		return cell{raw, fmt.Sprint(raw)}
+	}
+}
+
+// formatBytes 1024 进制，保留一位小数
+func formatBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for ; (n >= 1024 || n <= -1024) && i < len(units)-1; i++ {
+		n /= 1024
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+// roundDuration 一秒以上精确到秒，一秒以内精确到毫秒
+func roundDuration(d time.Duration) time.Duration {
+	if d >= time.Second || d <= -time.Second {
+		return d.Round(time.Second)
+	}
+	return d.Round(time.Millisecond)
+}
@@ -1,9 +1,185 @@
 package table
 
 import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/lipgloss"
 )
 
 type Grid interface {
 	Render() ([]table.Column, []table.Row)
+	// SetQuery 设置搜索、过滤和排序条件，之后的 Render 只返回符合条件的行
+	SetQuery(q Query)
+	// Len 不考虑条件的总行数
+	Len() int
+	// Export 按照 format 导出符合条件的行
+	Export(w io.Writer, format string) error
+}
+
+// Query 表格的搜索、按列过滤和排序条件，零值表示全部展示
+type Query struct {
+	Search string // 在所有列中搜索，不区分大小写
+	Column string // 按列过滤的列名
+	Value  string // 按列过滤的值，包含即可，不区分大小写
+	Sort   int    // 按第几列排序，从1开始，0 表示保持原来的顺序
+	Desc   bool   // 倒序
+}
+
+// Empty 是否没有任何条件
+func (q Query) Empty() bool {
+	return q.Search == "" && (q.Column == "" || q.Value == "") && q.Sort == 0
+}
+
+// renderRows 计算列宽并按照条件过滤和排序，列宽按照全部的行的显示宽度计算，过滤时不会跳动
+func renderRows(headers []string, rows [][]any, q Query) (columns []table.Column, result []table.Row) {
+	columns = make([]table.Column, len(headers))
+	lines := make([]table.Row, 0, len(rows))
+
+	maxLen := make(map[int]int, len(headers))
+	for _, v := range rows {
+		tmpLine := make([]string, 0, len(v))
+		for k := range v {
+			tmpItem := fmt.Sprint(v[k])
+			if width := lipgloss.Width(tmpItem); width > maxLen[k] {
+				maxLen[k] = width
+			}
+			tmpLine = append(tmpLine, tmpItem)
+		}
+		lines = append(lines, tmpLine)
+	}
+	for i, v := range headers {
+		if width := lipgloss.Width(v); width > maxLen[i] {
+			maxLen[i] = width
+		}
+		columns[i] = table.Column{
+			Title: v,
+			Width: maxLen[i] + 3,
+		}
+	}
+
+	if q.Empty() {
+		return columns, lines
+	}
+
+	filterColumn := -1
+	if q.Value != "" {
+		for i, v := range headers {
+			if v == q.Column {
+				filterColumn = i
+			}
+		}
+	}
+	search := strings.ToLower(q.Search)
+	value := strings.ToLower(q.Value)
+
+	matched := make([]int, 0, len(lines))
+	for i, line := range lines {
+		if filterColumn >= 0 && (filterColumn >= len(line) || !strings.Contains(strings.ToLower(line[filterColumn]), value)) {
+			continue
+		}
+		if search != "" && !containsAny(line, search) {
+			continue
+		}
+		matched = append(matched, i)
+	}
+
+	if q.Sort > 0 && q.Sort <= len(headers) {
+		k := q.Sort - 1
+		sort.SliceStable(matched, func(i, j int) bool {
+			a, b := rows[matched[i]], rows[matched[j]]
+			if k >= len(a) || k >= len(b) {
+				return false
+			}
+			if q.Desc {
+				return lessValue(b[k], a[k])
+			}
+			return lessValue(a[k], b[k])
+		})
+	}
+
+	result = make([]table.Row, 0, len(matched))
+	for _, i := range matched {
+		result = append(result, lines[i])
+	}
+	return columns, result
+}
+
+func containsAny(line []string, search string) bool {
+	for _, item := range line {
+		if strings.Contains(strings.ToLower(item), search) {
+			return true
+		}
+	}
+	return false
+}
+
+// lessValue 两边都是数字时按照数值比较，都是时间时按照时间比较，否则按照字符串比较
+// 格式化过的值使用原来的值比较
+func lessValue(a, b any) bool {
+	if c, ok := a.(cell); ok {
+		a = c.value
+	}
+	if c, ok := b.(cell); ok {
+		b = c.value
+	}
+	ta, okA := a.(time.Time)
+	tb, okB := b.(time.Time)
+	if okA && okB {
+		return ta.Before(tb)
+	}
+	fa, okA := toFloat(a)
+	fb, okB := toFloat(b)
+	if okA && okB {
+		return fa < fb
+	}
+	return fmt.Sprint(a) < fmt.Sprint(b)
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		// 自定义的数字类型，比如 time.Duration
+		rv := reflect.ValueOf(v)
+		switch {
+		case rv.CanInt():
+			return float64(rv.Int()), true
+		case rv.CanUint():
+			return float64(rv.Uint()), true
+		case rv.CanFloat():
+			return rv.Float(), true
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(fmt.Sprint(v)), 64)
+		return f, err == nil
+	}
 }
@@ -0,0 +1,164 @@
+package table
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+)
+
+type gridItem struct {
+	Name string `gird_column:"名字" gird_sort:"1"`
+	Size int64  `gird_column:"大小" gird_sort:"2"`
+}
+
+func TestObjectGridQuery(t *testing.T) {
+	grid := NewGrid([]gridItem{{"b.log", 10}, {"a.log", 9}, {"c.txt", 100}})
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"empty", Query{}, []string{"b.log", "a.log", "c.txt"}},
+		{"search", Query{Search: "LOG"}, []string{"b.log", "a.log"}},
+		{"filter column", Query{Column: "大小", Value: "10"}, []string{"b.log", "c.txt"}},
+		{"sort by number", Query{Sort: 2}, []string{"a.log", "b.log", "c.txt"}},
+		{"sort desc", Query{Sort: 2, Desc: true}, []string{"c.txt", "b.log", "a.log"}},
+		{"search and sort", Query{Search: "log", Sort: 1}, []string{"a.log", "b.log"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grid.SetQuery(tt.query)
+			columns, rows := grid.Render()
+			if len(columns) != 2 {
+				t.Fatalf("got %d columns, want 2", len(columns))
+			}
+			got := make([]string, 0, len(rows))
+			for _, row := range rows {
+				got = append(got, row[0])
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	if grid.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", grid.Len())
+	}
+}
+
+func TestObjectGridExport(t *testing.T) {
+	grid := NewGrid([]gridItem{{"b|x.log", 10}, {"a.log", 9}})
+	grid.SetQuery(Query{Sort: 2})
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{ExportCSV, "名字,大小\na.log,9\nb|x.log,10\n"},
+		{ExportJSON, "[\n  {\"名字\": \"a.log\", \"大小\": \"9\"},\n  {\"名字\": \"b|x.log\", \"大小\": \"10\"}\n]\n"},
+		{ExportMarkdown, "| 名字 | 大小 |\n| --- | --- |\n| a.log | 9 |\n| b\\|x.log | 10 |\n"},
+		{ExportPlain, "名字     大小\na.log    9\nb|x.log  10\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var b strings.Builder
+			if err := grid.Export(&b, tt.format); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", b.String(), tt.want)
+			}
+		})
+	}
+
+	if err := grid.Export(&strings.Builder{}, "xml"); err == nil {
+		t.Error("want error for unknown format")
+	}
+	if got := ExportFormatOf("out.MD"); got != ExportMarkdown {
+		t.Errorf("ExportFormatOf(out.MD) = %s", got)
+	}
+}
+
+func TestFitColumns(t *testing.T) {
+	columns := []table.Column{{Title: "路径", Width: 40}, {Title: "主题", Width: 10}, {Title: "大小", Width: 4}}
+
+	got := fitColumns(columns, 40)
+	want := []int{20, 10, 4}
+	for i := range want {
+		if got[i].Width != want[i] {
+			t.Fatalf("fitColumns(40) = %v, want widths %v", got, want)
+		}
+	}
+	if columns[0].Width != 40 {
+		t.Error("fitColumns changed the input columns")
+	}
+
+	// 放不下时最多缩小到最小宽度
+	got = fitColumns(columns, 10)
+	want = []int{minColumnWidth, minColumnWidth, 4}
+	for i := range want {
+		if got[i].Width != want[i] {
+			t.Fatalf("fitColumns(10) = %v, want widths %v", got, want)
+		}
+	}
+}
+
+type gridStatus struct {
+	Lines int64   `gird_column:"行数" gird_sort:"2"`
+	Bytes int64   `gird_column:"字节" gird_sort:"1" gird_format:"bytes"`
+	Ratio float64 `gird_column:"比例" gird_format:"percent"`
+}
+
+type gridName string
+
+func (n gridName) String() string { return "<" + string(n) + ">" }
+
+type gridNested struct {
+	Name    gridName      `gird_column:"名字" gird_sort:"1"`
+	Status  *gridStatus   `gird_column:"状态" gird_sort:"2"`
+	Updated time.Time     `gird_column:"更新" gird_sort:"3" gird_format:"time:15:04"`
+	Wait    time.Duration `gird_column:"等待" gird_sort:"4" gird_format:"duration"`
+	Tags    []string      `gird_column:"标签" gird_sort:"5"`
+	Err     error         `gird_column:"错误" gird_sort:"6"`
+	Ignored map[string]int
+}
+
+func TestObjectGridNested(t *testing.T) {
+	updated := time.Date(2023, 6, 1, 8, 30, 0, 0, time.UTC)
+	grid := NewGrid([]gridNested{
+		{Name: "a", Status: &gridStatus{Lines: 3, Bytes: 2048, Ratio: 0.5}, Updated: updated, Wait: 90 * time.Second, Tags: []string{"x", "y"}, Err: errors.New("boom")},
+		{Name: "b", Wait: 1500 * time.Millisecond},
+	})
+
+	wantHeaders := []string{"名字", "状态.字节", "状态.行数", "状态.比例", "更新", "等待", "标签", "错误"}
+	if got := grid.Headers(); strings.Join(got, " ") != strings.Join(wantHeaders, " ") {
+		t.Fatalf("Headers() = %v, want %v", got, wantHeaders)
+	}
+
+	_, rows := grid.Render()
+	want := [][]string{
+		{"<a>", "2.0 KiB", "3", "50.0%", "08:30", "1m30s", "x,y", "boom"},
+		{"<b>", "-", "-", "-", "-", "2s", "", "-"},
+	}
+	for i := range want {
+		if strings.Join(rows[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("row %d = %v, want %v", i, rows[i], want[i])
+		}
+	}
+
+	// 格式化之后仍然按照原来的值排序
+	grid.SetQuery(Query{Sort: 6})
+	if _, rows := grid.Render(); rows[0][0] != "<b>" {
+		t.Errorf("sort by duration got %v first", rows[0][0])
+	}
+}
@@ -2,6 +2,8 @@ package table
 
 import (
 	"fmt"
+	"io"
+	"sort"
 
 	"github.com/charmbracelet/bubbles/table"
 )
@@ -14,6 +16,7 @@ type GridAccess interface {
 type MapGrid[H, T GridAccess] struct {
 	d       []map[H]T
 	headers []H
+	query   Query // 搜索、过滤和排序条件
 }
 
 // NewMapGrid 创建一个网格数据
@@ -24,7 +27,7 @@ func NewMapGrid[H, T GridAccess](items []map[H]T) *MapGrid[H, T] {
 	}
 }
 
-// 手动设置表头，如果不设置表头,则会自动获取，但是不保证顺序,可恶...
+// 手动设置表头，如果不设置表头,则会自动获取，按照表头本身排序
 func (i *MapGrid[H, T]) SetHeaders(headers ...H) *MapGrid[H, T] {
 	i.headers = headers
 	return i
@@ -42,6 +45,8 @@ func (i *MapGrid[H, T]) Headers() []H {
 		}
 	}
 	s := MapKeys(set)
+	// 按照表头排序，重新渲染时列的顺序不会变
+	sort.Slice(s, func(a, b int) bool { return s[a] < s[b] })
 	return s
 }
 
@@ -75,39 +80,38 @@ func (i *MapGrid[H, T]) Rows() [][]T {
 	return s
 }
 
+// SetQuery 设置条件，不需要重新创建表格
+func (i *MapGrid[H, T]) SetQuery(q Query) {
+	i.query = q
+}
+
+// Len 全部数据的行数
+func (i *MapGrid[H, T]) Len() int {
+	return len(i.d)
+}
+
+// Export 导出成 csv json markdown 或者对齐的纯文本，和 Render 使用同样的表头和条件
+func (i *MapGrid[H, T]) Export(w io.Writer, format string) error {
+	columns, rows := i.Render()
+	return export(w, format, columns, rows)
+}
+
 // Render render一组Table所需的数据格式
 func (i *MapGrid[H, T]) Render() (columns []table.Column, rows []table.Row) {
 	gmpHeaders := i.Headers()
-	gmpRows := i.Rows()
-	columns = make([]table.Column, 0, len(gmpHeaders))
-	rows = make([]table.Row, 0, len(gmpRows))
+	headers := make([]string, 0, len(gmpHeaders))
+	for _, v := range gmpHeaders {
+		headers = append(headers, fmt.Sprint(v))
+	}
 
-	maxLen := make(map[int]int, len(gmpHeaders))
+	gmpRows := i.Rows()
+	lines := make([][]any, 0, len(gmpRows))
 	for _, v := range gmpRows {
-		tmpLine := make([]string, 0)
+		line := make([]any, 0, len(v))
 		for k := range v {
-			tmpItem := fmt.Sprint(v[k])
-			if len(tmpItem) > maxLen[k] {
-				maxLen[k] = len(tmpItem)
-			}
-			tmpLine = append(tmpLine, tmpItem)
-		}
-		rows = append(rows, tmpLine)
-	}
-
-	for i, v := range gmpHeaders {
-
-		header := fmt.Sprint(v)
-
-		if len(header) > maxLen[i] {
-			maxLen[i] = len(header)
-		}
-
-		column := table.Column{
-			Title: header,
-			Width: maxLen[i] + 3,
+			line = append(line, v[k])
 		}
-		columns = append(columns, column)
+		lines = append(lines, line)
 	}
-	return
+	return renderRows(headers, lines, i.query)
 }
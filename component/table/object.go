@@ -1,7 +1,7 @@
 package table
 
 import (
-	"fmt"
+	"io"
 	"reflect"
 	"sort"
 	"strconv"
@@ -11,9 +11,11 @@ import (
 
 type ObjectGrid[T any] struct {
 	d       []T
-	headers map[string]string // map[结构体Field]表头翻译
-	sort    map[int]string    // 表头字段的排序
-	define  map[string]string // 自定义表头
+	headers map[string]string    // map[结构体Field]表头翻译，嵌套的字段为 Status.Lines
+	sort    map[int]string       // 表头字段的排序
+	fields  map[string]gridField // 每一列对应的字段
+	define  map[string]string    // 自定义表头
+	query   Query                // 搜索、过滤和排序条件
 }
 
 // NewMapGird 创建一个网格数据
@@ -26,6 +28,7 @@ func NewGrid[T any](items []T) *ObjectGrid[T] {
 }
 
 // 手动设置表头，如果不设置表头,则会自动获取，排序一定是按照对象的Field顺序的
+// 嵌套结构体中的字段使用 Status.Lines 这样的路径
 func (o *ObjectGrid[T]) DefineHeader(define map[string]string) *ObjectGrid[T] {
 	o.define = define
 	return o
@@ -39,6 +42,9 @@ func (o *ObjectGrid[T]) guessHeaders() {
 	// 所以我们要先判断是不是指针，如果是指针给一次机会
 	eg := *new(T)
 	t := reflect.TypeOf(eg)
+	if t == nil {
+		return
+	}
 	// 再给一次机会，判断是否为指针
 	if t.Kind() == reflect.Ptr {
 		t = t.Elem()
@@ -49,51 +55,70 @@ func (o *ObjectGrid[T]) guessHeaders() {
 	}
 
 	o.sort = make(map[int]string, 0)
+	o.fields = make(map[string]gridField, 0)
+	for i, path := range o.guessFields(t, nil, "", "") {
+		o.sort[i+1] = path
+	}
+}
+
+// guessFields 按照 gird_sort 排好顺序的字段，嵌套的结构体展开成多列
+// 带 gird_column 的结构体字段，里面的列名以它为前缀，比如 状态.行数，匿名嵌入的结构体直接展开
+func (o *ObjectGrid[T]) guessFields(t reflect.Type, index []int, path, prefix string) []string {
+	sorted := make(map[int][]string, 0)
 	unSort := make([]string, 0)
 	for i := 0; i < t.NumField(); i++ {
 		currentField := t.Field(i)
+		if !currentField.IsExported() {
+			continue
+		}
+		currentFieldTag := currentField.Tag.Get("gird_column")
+		currentIndex := append(append([]int{}, index...), i)
+		currentPath := path + currentField.Name
+
+		var columns []string
+		switch {
+		case isNested(currentField.Type) && (currentFieldTag != "" || currentField.Anonymous):
+			nestedPrefix := prefix
+			if currentFieldTag != "" {
+				nestedPrefix = prefix + currentFieldTag + "."
+			}
+			columns = o.guessFields(indirect(currentField.Type), currentIndex, currentPath+".", nestedPrefix)
+		case currentFieldTag != "" && displayable(currentField.Type):
+			o.headers[currentPath] = prefix + currentFieldTag
+			o.fields[currentPath] = gridField{index: currentIndex, format: currentField.Tag.Get("gird_format")}
+			columns = []string{currentPath}
+		}
 
-		typeOfCurrentField := currentField.Type
-		if typeOfCurrentField.Kind() == reflect.Ptr {
-			typeOfCurrentField = currentField.Type.Elem()
+		if defineTag, ok := o.define[currentPath]; ok {
+			o.headers[currentPath] = defineTag
 		}
-		if typeOfCurrentField.Kind() > reflect.Complex128 && typeOfCurrentField.Kind() != reflect.String {
+		if len(columns) == 0 {
 			continue
 		}
 
-		currentFieldTag := t.Field(i).Tag.Get("gird_column")
-
-		if currentFieldTag != "" {
-			o.headers[currentField.Name] = currentFieldTag
-			currentFieldSort := t.Field(i).Tag.Get("gird_sort")
-			if currentFieldSort != "" {
-				fieldSort, err := strconv.Atoi(currentFieldSort)
-				if err == nil {
-					for i := fieldSort; ; i++ {
-						if _, get := o.sort[i]; !get {
-							o.sort[i] = currentField.Name
-							break
-						}
-					}
-				}
-			} else {
-				unSort = append(unSort, currentField.Name)
-			}
+		fieldSort, err := strconv.Atoi(currentField.Tag.Get("gird_sort"))
+		if err != nil {
+			unSort = append(unSort, columns...)
+			continue
 		}
-
-		if defineTag, ok := o.define[currentField.Name]; ok {
-			o.headers[currentField.Name] = defineTag
+		for i := fieldSort; ; i++ {
+			if _, get := sorted[i]; !get {
+				sorted[i] = columns
+				break
+			}
 		}
 	}
 
 	// 最后吧没有指定排序的加上
-	for _, v := range unSort {
-		o.sort[len(o.sort)+1] = v
+	result := make([]string, 0)
+	for _, columns := range sortIntKeyMap(sorted) {
+		result = append(result, columns...)
 	}
+	return append(result, unSort...)
 }
 
 func (o *ObjectGrid[T]) Headers() []string {
-	if o.sort == nil || len(o.sort) == 0 {
+	if len(o.sort) == 0 || o.fields == nil {
 		// 没有初始化排序的话，去初始化排序，有了排序才可以计算列表头
 		o.guessHeaders()
 	}
@@ -128,84 +153,55 @@ func sortIntKeyMap[T any](m map[int]T) []T {
 func (o *ObjectGrid[T]) Rows() [][]any {
 	s := make([][]any, 0)
 
-	getIndex := func(s string) int {
-		for i, v := range o.sort {
-			if v == s {
-				return i
-			}
-		}
-		return -1
+	if o.fields == nil {
+		o.guessHeaders()
 	}
-	// fmt.Println(sortColumns)
+	columns := sortIntKeyMap(o.sort)
 	for _, m := range o.d {
 		// m 是 T
-		t := reflect.TypeOf(m)
-		if t.Kind() == reflect.Ptr {
-			t = t.Elem()
-		}
-		if t.Kind() != reflect.Struct {
-			continue
-		}
-
-		tmp := make(map[int]any, 0)
-
 		v := reflect.ValueOf(m)
 		if v.Kind() == reflect.Ptr {
 			v = v.Elem()
 		}
-		for i := 0; i < t.NumField(); i++ {
-			field := v.Field(i)
-
-			if field.Kind() == reflect.Ptr {
-				field = field.Elem()
-			}
+		if v.Kind() != reflect.Struct {
+			continue
+		}
 
-			if field.Kind() > reflect.Complex128 && field.Kind() != reflect.String {
+		line := make([]any, 0, len(columns))
+		for _, path := range columns {
+			field := o.fields[path]
+			value, err := v.FieldByIndexErr(field.index)
+			if err != nil {
+				// 嵌套的结构体指针为 nil
+				line = append(line, emptyCell)
 				continue
 			}
-
-			currentField := t.Field(i)
-
-			if _, ok := o.headers[currentField.Name]; ok {
-				if getIndex(currentField.Name) >= 0 {
-					tmp[getIndex(currentField.Name)] = field.Interface()
-				}
-			}
+			line = append(line, formatValue(value, field.format))
 		}
-
-		s = append(s, sortIntKeyMap(tmp))
+		s = append(s, line)
 	}
 
 	return s
 }
 
+// SetQuery 设置条件，不需要重新创建表格
+func (o *ObjectGrid[T]) SetQuery(q Query) {
+	o.query = q
+}
+
+// Len 全部数据的行数
+func (o *ObjectGrid[T]) Len() int {
+	return len(o.d)
+}
+
+// Export 导出成 csv json markdown 或者对齐的纯文本，和 Render 使用同样的表头和条件
+func (o *ObjectGrid[T]) Export(w io.Writer, format string) error {
+	columns, rows := o.Render()
+	return export(w, format, columns, rows)
+}
+
 // Render render一组Table所需的数据格式
 func (o *ObjectGrid[T]) Render() (columns []table.Column, rows []table.Row) {
 	gopHeaders := o.Headers()
-	gopRows := o.Rows()
-	columns = make([]table.Column, len(gopHeaders))
-	rows = make([]table.Row, 0, len(gopRows))
-
-	maxLen := make(map[int]int, len(gopHeaders))
-	for _, v := range gopRows {
-		tmpLine := make([]string, 0)
-		for k := range v {
-			tmpItem := fmt.Sprint(v[k])
-			if len(tmpItem) > maxLen[k] {
-				maxLen[k] = len(tmpItem)
-			}
-			tmpLine = append(tmpLine, tmpItem)
-		}
-		rows = append(rows, tmpLine)
-	}
-	for i, v := range gopHeaders {
-		if len(v) > maxLen[i] {
-			maxLen[i] = len(v)
-		}
-		columns[i] = table.Column{
-			Title: v,
-			Width: maxLen[i] + 3,
-		}
-	}
-	return
+	return renderRows(gopHeaders, o.Rows(), o.query)
 }
@@ -2,10 +2,14 @@ package table
 
 import (
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
@@ -19,21 +23,66 @@ func MapKeys[Key comparable, T any](m map[Key]T) []Key {
 	return s
 }
 
-// 表格的搜索query like
+// 表格的搜索query like，Search 是列名，Value 是要包含的值
 type TableSearchQuery struct {
 	Search string
 	Value  string
 }
 
-var baseStyle = lipgloss.NewStyle().
-	BorderStyle(lipgloss.NormalBorder()).
-	BorderForeground(lipgloss.Color("#6EAF23"))
+// 表格之外占用的行数：边框 2 行，表头 2 行，底部的状态、输入框和帮助各 1 行
+const tableChrome = 7
+
+// 每列左右的空白，以及缩小列宽时最少保留的宽度
+const (
+	cellPadding    = 2
+	minColumnWidth = 6
+)
+
+// 输入框的状态
+type inputMode int
+
+const (
+	modeNormal inputMode = iota
+	modeSearch           // 正在输入搜索的内容
+	modeFilter           // 正在输入按列过滤的条件
+	modeExport           // 正在输入导出的文件名
+)
 
 type HermersTable struct {
 	keyMap keyMap
 	table  table.Model
 	help   help.Model
-	board  string
+	data   Grid
+	query  Query
+	mode   inputMode
+	input  textinput.Model
+	status string // 最近一次操作的结果，比如导出
+
+	columns []table.Column // 按内容计算的列宽，终端不够宽时再缩小
+	width   int            // 终端的大小，为 0 时还没有收到 WindowSizeMsg
+	height  int
+
+	detail     DetailFunc // 为 nil 时 enter 没有作用
+	detailRow  []string   // 正在查看详情的行，为 nil 时展示表格
+	detailView []string
+	follow     bool // 详情跟随模式，每秒刷新一次
+	followGen  int  // 每次开启跟随加一，之前开启时排的刷新不再生效
+}
+
+// 跟随模式下刷新详情的间隔
+const followInterval = time.Second
+
+// followMsg 带着开启跟随时的 followGen，关闭再开启后旧的刷新链就断了
+type followMsg int
+
+func followTick(gen int) tea.Cmd {
+	return tea.Tick(followInterval, func(time.Time) tea.Msg { return followMsg(gen) })
+}
+
+// WithDetail 设置详情，选中一行按 enter 时展示，esc 返回表格
+func (m HermersTable) WithDetail(detail DetailFunc) HermersTable {
+	m.detail = detail
+	return m
 }
 
 func (m HermersTable) Init() tea.Cmd { return nil }
@@ -42,10 +91,21 @@ func (m HermersTable) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
-		// If we set a width on the help menu it can gracefully truncate
-		// its view as needed.
-		m.help.Width = msg.Width
+		m.resize(msg.Width, msg.Height)
+		return m, nil
+	case followMsg:
+		if m.detailRow == nil || !m.follow || int(msg) != m.followGen {
+			return m, nil
+		}
+		m.loadDetail()
+		return m, followTick(m.followGen)
 	case tea.KeyMsg:
+		if m.detailRow != nil {
+			return m.updateDetail(msg)
+		}
+		if m.mode != modeNormal {
+			return m.updateInput(msg)
+		}
 		switch {
 		case key.Matches(msg, m.keyMap.Focus):
 			if m.table.Focused() {
@@ -57,31 +117,307 @@ func (m HermersTable) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tea.Quit
 		case key.Matches(msg, m.keyMap.Help):
 			m.help.ShowAll = !m.help.ShowAll
+			m.layout()
+			return m, cmd
+		case key.Matches(msg, m.keyMap.Search):
+			m.mode = modeSearch
+			m.input.Prompt = "/"
+			m.input.Placeholder = "搜索所有列"
+			m.input.SetValue(m.query.Search)
+			m.input.CursorEnd()
+			return m, m.input.Focus()
+		case key.Matches(msg, m.keyMap.Filter):
+			m.mode = modeFilter
+			m.input.Prompt = "过滤: "
+			m.input.Placeholder = "列名=值，tab 切换列，为空时清除"
+			m.input.SetValue("")
+			if m.query.Column != "" && m.query.Value != "" {
+				m.input.SetValue(m.query.Column + "=" + m.query.Value)
+			}
+			m.input.CursorEnd()
+			return m, m.input.Focus()
+		case key.Matches(msg, m.keyMap.Export):
+			m.mode = modeExport
+			m.input.Prompt = "导出到: "
+			m.input.Placeholder = "文件名，根据扩展名导出 csv json md，其他为纯文本"
+			m.input.SetValue("bifrost.md")
+			m.input.CursorEnd()
+			return m, m.input.Focus()
+		case key.Matches(msg, m.keyMap.Sort):
+			m.toggleSort(int(msg.Runes[0] - '0'))
 			return m, cmd
 		case key.Matches(msg, m.keyMap.Enter):
-			return m, tea.Batch(
-				tea.Printf("Let's go to %s!", m.table.SelectedRow()[1]),
-				// TODO： 刷新表格内部数据和标题
-			)
+			if row := m.table.SelectedRow(); m.detail != nil && len(row) > 0 {
+				m.detailRow = row
+				m.loadDetail()
+			}
+			return m, cmd
 		}
 	}
 	m.table, cmd = m.table.Update(msg)
 	return m, cmd
 }
 
+// updateDetail 查看详情时的按键，esc 返回表格，f 切换跟随模式
+func (m HermersTable) updateDetail(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.keyMap.Quit):
+		return m, tea.Quit
+	case key.Matches(msg, m.keyMap.Focus):
+		m.detailRow, m.detailView, m.follow = nil, nil, false
+	case key.Matches(msg, m.keyMap.Follow):
+		m.follow = !m.follow
+		if m.follow {
+			m.followGen++
+			m.loadDetail()
+			return m, followTick(m.followGen)
+		}
+	}
+	return m, nil
+}
+
+// loadDetail 重新获取正在查看的行的详情
+func (m *HermersTable) loadDetail() {
+	lines, err := m.detail(m.detailRow)
+	if err != nil {
+		lines = append(lines, fmt.Sprintf("error: %s", err))
+	}
+	m.detailView = lines
+}
+
+// updateInput 输入搜索或者过滤条件时，按键都交给输入框
+func (m HermersTable) updateInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		return m, tea.Quit
+	case tea.KeyEsc:
+		// 取消搜索会清除搜索条件，取消过滤保持原来的条件
+		if m.mode == modeSearch {
+			m.query.Search = ""
+			m.refresh()
+		}
+		m.mode = modeNormal
+		m.input.Blur()
+		return m, cmd
+	case tea.KeyEnter:
+		switch m.mode {
+		case modeFilter:
+			column, value, _ := strings.Cut(m.input.Value(), "=")
+			m.query.Column, m.query.Value = strings.TrimSpace(column), strings.TrimSpace(value)
+			m.refresh()
+		case modeExport:
+			m.status = m.export(strings.TrimSpace(m.input.Value()))
+		}
+		m.mode = modeNormal
+		m.input.Blur()
+		return m, cmd
+	case tea.KeyTab:
+		if m.mode == modeFilter {
+			m.input.SetValue(m.nextColumn(m.input.Value()) + "=")
+			m.input.CursorEnd()
+			return m, cmd
+		}
+	}
+
+	m.input, cmd = m.input.Update(msg)
+	if m.mode == modeSearch {
+		// 边输入边搜索
+		m.query.Search = m.input.Value()
+		m.refresh()
+	}
+	return m, cmd
+}
+
+// export 把当前条件下的表格写入文件，返回结果
+func (m HermersTable) export(name string) string {
+	if name == "" {
+		return "导出失败: 文件名为空"
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Sprintf("导出失败: %s", err)
+	}
+	err = m.data.Export(f, ExportFormatOf(name))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Sprintf("导出失败: %s", err)
+	}
+	return fmt.Sprintf("已导出 %d 行到 %s", len(m.table.Rows()), name)
+}
+
+// nextColumn 当前输入的列名的下一列，用来在过滤时切换列
+func (m HermersTable) nextColumn(current string) string {
+	column, _, _ := strings.Cut(current, "=")
+	titles := m.titles()
+	if len(titles) == 0 {
+		return ""
+	}
+	for i, title := range titles {
+		if title == column {
+			return titles[(i+1)%len(titles)]
+		}
+	}
+	return titles[0]
+}
+
+// toggleSort 按第 n 列排序，再按一次倒序，第三次恢复原来的顺序，0 清除排序
+func (m *HermersTable) toggleSort(n int) {
+	switch {
+	case n == 0 || n > len(m.titles()):
+		m.query.Sort, m.query.Desc = 0, false
+	case m.query.Sort != n:
+		m.query.Sort, m.query.Desc = n, false
+	case !m.query.Desc:
+		m.query.Desc = true
+	default:
+		m.query.Sort, m.query.Desc = 0, false
+	}
+	m.refresh()
+}
+
+// titles 没有排序标记的列名
+func (m HermersTable) titles() []string {
+	columns, _ := m.data.Render()
+	titles := make([]string, 0, len(columns))
+	for _, column := range columns {
+		titles = append(titles, column.Title)
+	}
+	return titles
+}
+
+// SetData 替换表格的数据，保留当前的条件和光标
+func (m *HermersTable) SetData(data Grid) {
+	m.data = data
+	m.refresh()
+}
+
+// refresh 按照当前的条件重新渲染表格，不需要重新创建程序
+func (m *HermersTable) refresh() {
+	m.data.SetQuery(m.query)
+	columns, rows := m.data.Render()
+	if m.query.Sort > 0 && m.query.Sort <= len(columns) {
+		mark := " ↑"
+		if m.query.Desc {
+			mark = " ↓"
+		}
+		columns[m.query.Sort-1].Title += mark
+	}
+	// 行变少时先把光标移回来，避免越界
+	if m.table.Cursor() >= len(rows) {
+		m.table.SetCursor(0)
+	}
+	m.table.SetRows(rows)
+	m.columns = columns
+	m.layout()
+}
+
+// resize 终端大小变化时调整列宽和表格的高度
+func (m *HermersTable) resize(width, height int) {
+	m.width, m.height = width, height
+	// If we set a width on the help menu it can gracefully truncate
+	// its view as needed.
+	m.help.Width = width
+	m.layout()
+}
+
+// layout 按照终端的大小缩小列宽，超出的内容以省略号结尾，表格的高度跟随终端
+func (m *HermersTable) layout() {
+	columns := m.columns
+	if m.width > 0 {
+		// 减去左右的边框
+		columns = fitColumns(columns, m.width-2)
+	}
+	m.table.SetColumns(columns)
+
+	if m.height > 0 {
+		height := m.height - tableChrome
+		if m.help.ShowAll {
+			height -= len(m.keyMap.FullHelp()[0]) + 2
+		}
+		if height < 1 {
+			height = 1
+		}
+		m.table.SetHeight(height)
+	}
+}
+
+// fitColumns 总宽度超过 width 时，每次把最宽的一列缩小一格，直到放得下或者都缩小到最小宽度
+func fitColumns(columns []table.Column, width int) []table.Column {
+	fitted := make([]table.Column, len(columns))
+	copy(fitted, columns)
+
+	total := 0
+	for _, column := range fitted {
+		total += column.Width + cellPadding
+	}
+	for total > width {
+		widest := 0
+		for i := range fitted {
+			if fitted[i].Width > fitted[widest].Width {
+				widest = i
+			}
+		}
+		if len(fitted) == 0 || fitted[widest].Width <= minColumnWidth {
+			break
+		}
+		fitted[widest].Width--
+		total--
+	}
+	return fitted
+}
+
+// footer 行数以及当前的条件
+func (m HermersTable) footer() string {
+	total := m.data.Len()
+	footer := fmt.Sprintf("共 %d 行", total)
+	if shown := len(m.table.Rows()); shown != total {
+		footer = fmt.Sprintf("显示 %d / %d 行", shown, total)
+	}
+	if m.query.Search != "" {
+		footer += fmt.Sprintf(" | 搜索: %s", m.query.Search)
+	}
+	if m.query.Column != "" && m.query.Value != "" {
+		footer += fmt.Sprintf(" | 过滤: %s=%s", m.query.Column, m.query.Value)
+	}
+	if pages := m.pages(); pages > 1 {
+		footer += fmt.Sprintf(" | 第 %d / %d 页", m.table.Cursor()/m.table.Height()+1, pages)
+	}
+	if m.status != "" {
+		footer += " | " + m.status
+	}
+	return footer
+}
+
+// pages 按照表格的高度计算的总页数
+func (m HermersTable) pages() int {
+	height := m.table.Height()
+	if height <= 0 {
+		return 1
+	}
+	return (len(m.table.Rows()) + height - 1) / height
+}
+
 type keyMap struct {
-	base  table.KeyMap
-	Enter key.Binding
-	Quit  key.Binding
-	Help  key.Binding
-	Focus key.Binding
+	base   table.KeyMap
+	Enter  key.Binding
+	Quit   key.Binding
+	Help   key.Binding
+	Focus  key.Binding
+	Search key.Binding
+	Filter key.Binding
+	Sort   key.Binding
+	Follow key.Binding
+	Export key.Binding
 }
 
 func DefaultTableKeyMap() keyMap {
 	keyMapDefault := keyMap{
 		Enter: key.NewBinding(
 			key.WithKeys("enter"),
-			key.WithHelp("enter", "checkout item"),
+			key.WithHelp("enter", "detail"),
 		),
 		Quit: key.NewBinding(
 			key.WithKeys("ctrl+c"),
@@ -96,13 +432,33 @@ func DefaultTableKeyMap() keyMap {
 			key.WithHelp("esc", "focus"),
 			// 让表格锁定住不能动
 		),
+		Search: key.NewBinding(
+			key.WithKeys("/"),
+			key.WithHelp("/", "search"),
+		),
+		Filter: key.NewBinding(
+			key.WithKeys("c"),
+			key.WithHelp("c", "filter column"),
+		),
+		Sort: key.NewBinding(
+			key.WithKeys("0", "1", "2", "3", "4", "5", "6", "7", "8", "9"),
+			key.WithHelp("1-9", "sort by column"),
+		),
+		Export: key.NewBinding(
+			key.WithKeys("e"),
+			key.WithHelp("e", "export view"),
+		),
+		Follow: key.NewBinding(
+			key.WithKeys("f"),
+			key.WithHelp("f", "follow"),
+		),
 		base: table.DefaultKeyMap(),
 	}
 	return keyMapDefault
 }
 
 func (k keyMap) ShortHelp() []key.Binding {
-	return []key.Binding{k.base.LineUp, k.base.LineDown, k.Enter, k.Help}
+	return []key.Binding{k.base.LineUp, k.base.LineDown, k.Search, k.Enter, k.Help}
 }
 
 func (k keyMap) FullHelp() [][]key.Binding {
@@ -110,13 +466,37 @@ func (k keyMap) FullHelp() [][]key.Binding {
 		{k.base.LineUp, k.base.LineDown},    // first column
 		{k.base.GotoTop, k.base.GotoBottom}, // second column
 		{k.base.PageUp, k.base.PageDown},
+		{k.Search, k.Filter, k.Sort, k.Export},
 		{k.Quit, k.Focus},
 	}
 }
 
 func (m HermersTable) View() string {
+	if m.detailRow != nil {
+		return m.viewDetail()
+	}
 	tableHelp := m.help.View(m.keyMap)
-	return baseStyle.Render(m.table.View()) + "\n" + m.board + "\n" + tableHelp + "\n"
+	view := baseStyle.Render(m.table.View()) + "\n" + m.footer() + "\n"
+	if m.mode != modeNormal {
+		view += m.input.View() + "\n"
+	}
+	return view + tableHelp + "\n"
+}
+
+// viewDetail 详情页面
+func (m HermersTable) viewDetail() string {
+	title := lipgloss.NewStyle().Bold(true).Render(m.detailRow[0])
+	mode := "esc back • f follow"
+	if m.follow {
+		mode = "esc back • f stop following (following)"
+	}
+	lines := m.detailView
+	// 只保留能放下的最后几行，减去边框、标题和底部的帮助
+	if limit := m.height - 4; m.height > 0 && len(lines) > limit && limit > 0 {
+		lines = lines[len(lines)-limit:]
+	}
+	body := strings.Join(lines, "\n")
+	return detailStyle.Render(title+"\n"+body) + "\n" + m.help.Styles.ShortDesc.Render(mode) + "\n"
 }
 
 func newBaseTable(columns []table.Column, rows []table.Row) table.Model {
@@ -127,43 +507,28 @@ func newBaseTable(columns []table.Column, rows []table.Row) table.Model {
 		table.WithHeight(8),
 	)
 
-	s := table.DefaultStyles()
-	s.Header = s.Header.
-		BorderStyle(lipgloss.NormalBorder()).
-		BorderForeground(lipgloss.Color("240")).
-		BorderBottom(true).
-		Bold(true)
-	s.Selected = s.Selected.
-		Foreground(lipgloss.Color("229")).
-		Background(lipgloss.Color("57")).
-		Bold(false)
-	t.SetStyles(s)
+	t.SetStyles(tableStyles)
 	return t
 }
 
+// Create 创建表格，query 是初始的按列过滤条件
 func Create(data Grid, query ...TableSearchQuery) HermersTable {
-	columns, rows := data.Render()
-	var board string = fmt.Sprintf("当前收集日志文件%d个", len(rows))
+	var q Query
 	if len(query) > 0 && query[0].Search != "" && query[0].Value != "" {
-
-		for k, v := range columns {
-			if v.Title == query[0].Search {
-
-				searchedRows := make([]table.Row, 0, len(rows))
-				for _, v := range rows {
-					if v[k] == query[0].Value {
-						searchedRows = append(searchedRows, v)
-					}
-				}
-				board += fmt.Sprintf("正在搜索标题是%s并且值是%s的记录", query[0].Search, query[0].Value)
-				rows = searchedRows
-
-			}
-		}
-
+		q.Column, q.Value = query[0].Search, query[0].Value
 	}
+	data.SetQuery(q)
+	columns, rows := data.Render()
 
-	m := HermersTable{DefaultTableKeyMap(), newBaseTable(columns, rows), help.New(), board}
+	m := HermersTable{
+		keyMap:  DefaultTableKeyMap(),
+		table:   newBaseTable(columns, rows),
+		help:    help.New(),
+		data:    data,
+		query:   q,
+		input:   textinput.New(),
+		columns: columns,
+	}
 
 	return m
 }
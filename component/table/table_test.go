@@ -0,0 +1,46 @@
+package table
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestFollowTick(t *testing.T) {
+	loads := 0
+	m := Create(NewGrid([]gridItem{{"a.log", 1}})).WithDetail(func(row []string) ([]string, error) {
+		loads++
+		return row, nil
+	})
+	m.detailRow = []string{"a.log", "1"}
+
+	press := func(m HermersTable, msg tea.Msg) (HermersTable, tea.Cmd) {
+		model, cmd := m.Update(msg)
+		return model.(HermersTable), cmd
+	}
+	follow := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("f")}
+
+	// 在一次刷新之内关闭再开启跟随
+	m, _ = press(m, follow)
+	m, _ = press(m, follow)
+	m, _ = press(m, follow)
+	loads = 0
+
+	tests := []struct {
+		name  string
+		msg   followMsg
+		loads int
+		next  bool
+	}{
+		{"tick of the first follow", followMsg(m.followGen - 1), 0, false},
+		{"tick of the current follow", followMsg(m.followGen), 1, true},
+	}
+	for _, tt := range tests {
+		var cmd tea.Cmd
+		loads = 0
+		m, cmd = press(m, tt.msg)
+		if loads != tt.loads || (cmd != nil) != tt.next {
+			t.Errorf("%s: loaded %d times, next tick %v, want %d, %v", tt.name, loads, cmd != nil, tt.loads, tt.next)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package table
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// 表格的配色
+const (
+	ThemeDark  = "dark"
+	ThemeLight = "light"
+	ThemeNone  = "none" // 不使用颜色，选中的行反色展示
+)
+
+// Theme 表格用到的颜色
+type Theme struct {
+	Border     lipgloss.TerminalColor // 表格的边框
+	Line       lipgloss.TerminalColor // 表头下的分隔线和详情的边框
+	SelectedFg lipgloss.TerminalColor
+	SelectedBg lipgloss.TerminalColor
+}
+
+var themes = map[string]Theme{
+	ThemeDark: {
+		Border:     lipgloss.Color("#6EAF23"),
+		Line:       lipgloss.Color("240"),
+		SelectedFg: lipgloss.Color("229"),
+		SelectedBg: lipgloss.Color("57"),
+	},
+	ThemeLight: {
+		Border:     lipgloss.Color("#3C7A0B"),
+		Line:       lipgloss.Color("250"),
+		SelectedFg: lipgloss.Color("#1A1A1A"),
+		SelectedBg: lipgloss.Color("#B5D8FF"),
+	},
+	ThemeNone: {
+		Border:     lipgloss.NoColor{},
+		Line:       lipgloss.NoColor{},
+		SelectedFg: lipgloss.NoColor{},
+		SelectedBg: lipgloss.NoColor{},
+	},
+}
+
+var (
+	baseStyle   lipgloss.Style
+	detailStyle lipgloss.Style
+	tableStyles table.Styles
+)
+
+func init() {
+	applyTheme(themes[ThemeDark], false)
+}
+
+// DefaultTheme 设置了 NO_COLOR 环境变量时不使用颜色，否则使用 dark
+func DefaultTheme() string {
+	if os.Getenv("NO_COLOR") != "" {
+		return ThemeNone
+	}
+	return ThemeDark
+}
+
+// SetTheme 设置之后创建的表格的配色，name 为空时使用 DefaultTheme
+func SetTheme(name string) error {
+	if name == "" {
+		name = DefaultTheme()
+	}
+	theme, ok := themes[name]
+	if !ok {
+		return fmt.Errorf("theme(%s) must be one of dark, light, none", name)
+	}
+	applyTheme(theme, name == ThemeNone)
+	return nil
+}
+
+func applyTheme(theme Theme, noColor bool) {
+	if noColor {
+		// 帮助等其他组件的颜色也一起去掉
+		lipgloss.SetColorProfile(termenv.Ascii)
+	}
+
+	baseStyle = lipgloss.NewStyle().
+		BorderStyle(lipgloss.NormalBorder()).
+		BorderForeground(theme.Border)
+	detailStyle = lipgloss.NewStyle().
+		BorderStyle(lipgloss.RoundedBorder()).
+		BorderForeground(theme.Line)
+
+	tableStyles = table.DefaultStyles()
+	tableStyles.Header = tableStyles.Header.
+		BorderStyle(lipgloss.NormalBorder()).
+		BorderForeground(theme.Line).
+		BorderBottom(true).
+		Bold(true)
+	tableStyles.Selected = tableStyles.Selected.
+		Foreground(theme.SelectedFg).
+		Background(theme.SelectedBg).
+		Reverse(noColor).
+		Bold(false)
+}
@@ -1,17 +1,32 @@
 package conf
 
+import "time"
+
 type LogAgentConf struct {
-	App     `ini:"app"`
-	Kafka   `ini:"kafka"`
-	Etcd    `ini:"etcd"`
-	Runtime `ini:"runtime"`
-	Log     `ini:"log"`
+	App        `ini:"app"`
+	Kafka      `ini:"kafka"`
+	Etcd       `ini:"etcd"`
+	Runtime    `ini:"runtime"`
+	Log        `ini:"log"`
+	Metrics    `ini:"metrics"`
+	DeadLetter `ini:"dead_letter"`
 }
 
 // kafka 配置
 type Kafka struct {
-	Address   string `ini:"address"`
-	QueueSize int    `ini:"queue_size"`
+	Address      string        `ini:"address"`
+	QueueSize    int           `ini:"queue_size"`    // 单个批次的最大消息条数
+	BatchBytes   int           `ini:"batch_bytes"`   // 单个批次的最大字节数
+	Linger       time.Duration `ini:"linger"`        // 批次中第一条消息最多等待多久就发送
+	MemoryLimit  int64         `ini:"memory_limit"`  // 读出但还没有写入 Kafka 的日志最多占用的字节数
+	MaxRetries   int           `ini:"max_retries"`   // Kafka 返回可重试错误时最多重试几次
+	RetryBackoff time.Duration `ini:"retry_backoff"` // 第一次重试前的等待时间，之后每次翻倍
+}
+
+// 死信配置，Kafka 拒绝的消息优先写入 Topic，其次写入文件
+type DeadLetter struct {
+	Topic string `ini:"topic"`
+	File  string `ini:"file"`
 }
 
 // APP 属性
@@ -25,12 +40,25 @@ type Etcd struct {
 }
 
 type Runtime struct {
-	Path string `ini:"path"`
+	Path               string        `ini:"path"`
+	CheckpointInterval time.Duration `ini:"checkpoint_interval"` // 每隔多久记录一次读取位置
+}
+
+// 指标服务配置
+type Metrics struct {
+	Address string `ini:"address"`
+	Recent  bool   `ini:"recent"` // 是否提供收集器最近读到的原始日志，默认关闭
 }
 
 type Log struct {
-	Path string `ini:"path"`
-	Name string `ini:"name"`
+	Path        string        `ini:"path"`
+	Name        string        `ini:"name"`
+	Level       string        `ini:"level"`        // debug、info、warn、error，默认 info
+	Format      string        `ini:"format"`       // text 或者 json，默认 text
+	MaxSize     int64         `ini:"max_size"`     // 文件超过这个字节数时轮转，默认 100MB
+	RotateEvery time.Duration `ini:"rotate_every"` // 文件打开超过这个时间时轮转，默认不按时间轮转
+	MaxAge      time.Duration `ini:"max_age"`      // 轮转后的文件保留多久，默认 7 天
+	MaxBackups  int           `ini:"max_backups"`  // 最多保留几个轮转后的文件，默认 7 个
 }
 
 var (
@@ -3,7 +3,8 @@ package etcd
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"sort"
 	"strings"
 	"time"
 
@@ -12,10 +13,22 @@ import (
 )
 
 var (
-	configPath = "/logagent/config/"
-	statusPath = "/logagent/active/"
+	configPath    = "/logagent/config/"
+	statusPath    = "/logagent/active/"
+	heartbeatPath = "/logagent/heartbeat/"
 )
 
+// HeartbeatInterval 运行中的节点每隔多久记录一次心跳
+const HeartbeatInterval = 30 * time.Second
+
+// Node 一个节点在 etcd 中的全部信息
+type Node struct {
+	ID        string
+	Config    []byte    // 收集器配置，节点没有注册时为空
+	Active    string    // 激活状态，1 运行中 0 已退出，从来没有运行过时为空
+	Heartbeat time.Time // 最后一次心跳，没有心跳时为零值
+}
+
 var cli *clientv3.Client
 
 func Init() {
@@ -62,6 +75,102 @@ func GetLogConfToEtcd() ([]byte, error) {
 	return resp.Kvs[0].Value, nil
 }
 
+// GetCollectorConf 读取某个节点的收集器配置和它的修改版本，不会修改节点的激活状态
+// 节点还没有注册时返回空的配置和版本0，写入时会创建这个节点
+func GetCollectorConf(id string) ([]byte, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	resp, err := cli.Get(ctx, configPath+id)
+	cancel()
+	if err != nil {
+		return []byte{}, 0, fmt.Errorf("get failed, err:%s ", err)
+	}
+
+	if len(resp.Kvs) == 0 {
+		return []byte{}, 0, nil
+	}
+
+	return resp.Kvs[0].Value, resp.Kvs[0].ModRevision, nil
+}
+
+// PutCollectorConf 只有在配置的修改版本仍然是 rev 时才写入，返回 false 表示配置已经被别人修改过
+// rev 为0时表示节点还没有注册，只有在这个节点仍然不存在时才创建
+func PutCollectorConf(id string, value []byte, rev int64) (bool, error) {
+	key := configPath + id
+
+	cmp := clientv3.Compare(clientv3.ModRevision(key), "=", rev)
+	if rev == 0 {
+		cmp = clientv3.Compare(clientv3.CreateRevision(key), "=", 0)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	resp, err := cli.Txn(ctx).
+		If(cmp).
+		Then(clientv3.OpPut(key, string(value))).
+		Commit()
+	cancel()
+	if err != nil {
+		return false, fmt.Errorf("put failed, err:%s ", err)
+	}
+	return resp.Succeeded, nil
+}
+
+// Heartbeat 记录当前节点的心跳时间
+func Heartbeat() error {
+	key := heartbeatPath + conf.APPConfig.ID
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	_, err := cli.Put(ctx, key, time.Now().Format(time.RFC3339))
+	cancel()
+	if err != nil {
+		return fmt.Errorf("put failed, err:%s ", err)
+	}
+	return nil
+}
+
+// ListNodes 扫描所有节点的收集器配置、激活状态和心跳，按照节点名排序
+func ListNodes() ([]Node, error) {
+	nodes := make(map[string]*Node)
+	node := func(id string) *Node {
+		if _, ok := nodes[id]; !ok {
+			nodes[id] = &Node{ID: id}
+		}
+		return nodes[id]
+	}
+
+	for _, prefix := range []string{configPath, statusPath, heartbeatPath} {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix())
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("get failed, err:%s ", err)
+		}
+		for _, kv := range resp.Kvs {
+			id := strings.TrimPrefix(string(kv.Key), prefix)
+			if id == "" {
+				continue
+			}
+			switch prefix {
+			case configPath:
+				node(id).Config = kv.Value
+			case statusPath:
+				node(id).Active = string(kv.Value)
+			case heartbeatPath:
+				if t, err := time.Parse(time.RFC3339, string(kv.Value)); err == nil {
+					node(id).Heartbeat = t
+				}
+			}
+		}
+	}
+
+	result := make([]Node, 0, len(nodes))
+	for _, n := range nodes {
+		result = append(result, *n)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
 func CloseEvent() {
 	activeKey := statusPath + conf.APPConfig.ID
 
@@ -70,7 +179,7 @@ func CloseEvent() {
 		if err != nil {
 			panic(fmt.Sprintf("close failed, err:%s \n", err))
 		}
-		log.Println("close etcd succ")
+		slog.Info("etcd closed")
 	}()
 
 	// 注册激活状态
@@ -98,7 +207,7 @@ func GetDelRevValueFromEtcd(key string, rev int64) ([]byte, error) {
 	resp, err := cli.Get(ctx, key, clientv3.WithRev(rev))
 	cancel()
 	if err != nil {
-		log.Println(fmt.Sprintf("Get Etcd config failed, err:%s \n", err))
+		slog.Error("get etcd config failed", "err", err)
 	}
 
 	if len(resp.Kvs) == 0 {
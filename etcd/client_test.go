@@ -0,0 +1,64 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/y7ut/logagent/conf"
+)
+
+// 需要一个可以随意写入的 etcd，例如 BIFROST_TEST_ETCD=127.0.0.1:2379 go test ./etcd/
+func testEtcd(t *testing.T) {
+	address := os.Getenv("BIFROST_TEST_ETCD")
+	if address == "" {
+		t.Skip("BIFROST_TEST_ETCD is not set")
+	}
+	conf.APPConfig.Etcd.Address = address
+	Init()
+	t.Cleanup(func() { cli.Close() })
+}
+
+func TestPutCollectorConfNewNode(t *testing.T) {
+	testEtcd(t)
+	id := fmt.Sprintf("test-node-%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		cli.Delete(ctx, configPath+id)
+	})
+
+	// 还没有注册的节点是空的配置
+	value, rev, err := GetCollectorConf(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(value) != 0 || rev != 0 {
+		t.Fatalf("GetCollectorConf() of a new node = %q, %d, want empty and 0", value, rev)
+	}
+
+	first := `[{"style":"File","path":"/var/log/a.log","topic":"a"}]`
+	if ok, err := PutCollectorConf(id, []byte(first), 0); err != nil || !ok {
+		t.Fatalf("first PutCollectorConf() = %v, %v, want true", ok, err)
+	}
+	// 别人已经创建过了，再按照新节点写入会失败
+	if ok, err := PutCollectorConf(id, []byte(`[]`), 0); err != nil || ok {
+		t.Fatalf("create an existing node: PutCollectorConf() = %v, %v, want false", ok, err)
+	}
+
+	value, rev, err = GetCollectorConf(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != first || rev == 0 {
+		t.Fatalf("GetCollectorConf() = %q, %d, want %q", value, rev, first)
+	}
+	if ok, err := PutCollectorConf(id, []byte(`[]`), rev); err != nil || !ok {
+		t.Fatalf("PutCollectorConf() with the current revision = %v, %v, want true", ok, err)
+	}
+	if ok, err := PutCollectorConf(id, []byte(first), rev); err != nil || ok {
+		t.Fatalf("PutCollectorConf() with a stale revision = %v, %v, want false", ok, err)
+	}
+}
@@ -0,0 +1,73 @@
+package collection
+
+import (
+	"container/list"
+	"slices"
+	"testing"
+
+	"github.com/y7ut/logagent/pkg/collection/seq"
+)
+
+// listMapFilter 原来基于 container/list 的实现，每一步都复制一遍并且装箱，用来对比
+func listMapFilter(d []int, m func(int) int, f func(int) bool) []int {
+	l := list.New()
+	for _, v := range d {
+		l.PushBack(v)
+	}
+	for current := l.Front(); current != nil; current = current.Next() {
+		current.Value = m(current.Value.(int))
+	}
+	match := list.New()
+	for current := l.Back(); current != nil; current = current.Prev() {
+		if f(current.Value.(int)) {
+			match.PushFront(current.Value)
+		}
+	}
+	result := make([]int, 0)
+	for current := match.Front(); current != nil; current = current.Next() {
+		result = append(result, current.Value.(int))
+	}
+	return result
+}
+
+func benchData() []int {
+	d := make([]int, 10000)
+	for i := range d {
+		d[i] = i
+	}
+	return d
+}
+
+func BenchmarkMapFilterList(b *testing.B) {
+	d := benchData()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		listMapFilter(d, func(i int) int { return i * 3 }, func(i int) bool { return i%2 == 0 })
+	}
+}
+
+func BenchmarkMapFilterCollection(b *testing.B) {
+	d := benchData()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		New(d).Map(func(k int, i int) int { return i * 3 }).Filter(func(i int) bool { return i%2 == 0 }).Value()
+	}
+}
+
+func BenchmarkMapFilterSeq(b *testing.B) {
+	d := benchData()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s := seq.Map(slices.Values(d), func(k int, i int) int { return i * 3 })
+		_ = slices.Collect(seq.Filter(s, func(i int) bool { return i%2 == 0 }))
+	}
+}
+
+func BenchmarkMapFilterTakeSeq(b *testing.B) {
+	d := benchData()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s := seq.Map(slices.Values(d), func(k int, i int) int { return i * 3 })
+		_ = slices.Collect(seq.Take(seq.Filter(s, func(i int) bool { return i%2 == 0 }), 100))
+	}
+}
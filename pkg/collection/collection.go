@@ -1,38 +1,33 @@
 package collection
 
 import (
-	"container/list"
-	"reflect"
+	"iter"
+	"slices"
+
+	"github.com/y7ut/logagent/pkg/collection/seq"
 )
 
 type item interface {
 	any
 }
 
-// jian
+// Collection 每一步都会立即执行，需要惰性处理时使用 All 和 seq 包
 type Collection[T item] struct {
-	data      *list.List
-	itemIsPtr bool
+	data []T
 }
 
 func New[T item](d []T) *Collection[T] {
+	return &Collection[T]{data: slices.Clone(d)}
+}
 
-	t := reflect.TypeOf(*new(T))
-	var isPtr = t.Kind() == reflect.Ptr
-
-	l := list.New()
-	for _, item := range d {
-		t := item
-		l.PushBack(t)
-	}
-
-	return &Collection[T]{data: l, itemIsPtr: isPtr}
+// All can be used to start a lazy pipeline of the seq package
+func (c *Collection[T]) All() iter.Seq[T] {
+	return slices.Values(c.data)
 }
 
 // Each can be used to iterate over the collection
 func (c *Collection[T]) Each(f func(k int, i T)) *Collection[T] {
-	for current, i := c.data.Front(), 0; current != nil; current, i = current.Next(), i+1 {
-		var currentItem T = current.Value.(T)
+	for i, currentItem := range c.data {
 		f(i, currentItem)
 	}
 	return c
@@ -40,24 +35,13 @@ func (c *Collection[T]) Each(f func(k int, i T)) *Collection[T] {
 
 // Map can be used to map the collection
 func (c *Collection[T]) Map(f func(k int, i T) T) *Collection[T] {
-	for current, i := c.data.Front(), 0; current != nil; current, i = current.Next(), i+1 {
-		var currentItem T = current.Value.(T)
-		currentItem = f(i, currentItem)
-		current.Value = currentItem
-	}
+	c.data = slices.Collect(seq.Map(c.All(), f))
 	return c
 }
 
 // Filter can be used to filter the collection only when the function returns true
 func (c *Collection[T]) Filter(f func(i T) bool) *Collection[T] {
-	match := list.New()
-	for current := c.data.Back(); current != nil; current = current.Prev() {
-		var currentItem T = current.Value.(T)
-		if f(currentItem) {
-			match.PushFront(currentItem)
-		}
-	}
-	c.data = match
+	c.data = slices.Collect(seq.Filter(c.All(), f))
 	return c
 }
 
@@ -69,19 +53,15 @@ func (c *Collection[T]) Sort(f func(i, j T) bool) *Collection[T] {
 
 // Len can be used to get the length
 func (c *Collection[T]) Len() int {
-	return c.data.Len()
+	return len(c.data)
 }
 
 // Value can be used to get the value slice
 func (c *Collection[T]) Value() []T {
-	lt := make([]T, 0)
-	for current := c.data.Front(); current != nil; current = current.Next() {
-		var currentItem T = current.Value.(T)
-		lt = append(lt, currentItem)
-	}
-	return lt
+	lt := make([]T, 0, len(c.data))
+	return append(lt, c.data...)
 }
 
 func (c *Collection[T]) Merge(other *Collection[T]) {
-	c.data.PushBackList(other.data)
+	c.data = append(c.data, other.data...)
 }
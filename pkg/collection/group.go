@@ -0,0 +1,82 @@
+package collection
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/y7ut/logagent/pkg/collection/seq"
+)
+
+// KeyBy can be used to index the collection by key, the last element wins when keys are the same
+func KeyBy[T item, K comparable](c *Collection[T], key func(i T) K) map[K]T {
+	result := make(map[K]T, len(c.data))
+	for _, currentItem := range c.data {
+		result[key(currentItem)] = currentItem
+	}
+	return result
+}
+
+// GroupBy can be used to group the collection by key, elements keep their order in every group
+func GroupBy[T item, K comparable](c *Collection[T], key func(i T) K) map[K]*Collection[T] {
+	result := make(map[K]*Collection[T])
+	for k, group := range seq.GroupBy(c.All(), key) {
+		result[k] = &Collection[T]{data: group}
+	}
+	return result
+}
+
+// CountBy can be used to count elements of every key
+func CountBy[T item, K comparable](c *Collection[T], key func(i T) K) map[K]int {
+	result := make(map[K]int)
+	for _, currentItem := range c.data {
+		result[key(currentItem)]++
+	}
+	return result
+}
+
+// UniqueBy keeps the first element of every key, like Filter it changes the collection
+func UniqueBy[T item, K comparable](c *Collection[T], key func(i T) K) *Collection[T] {
+	c.data = slices.Collect(seq.Distinct(c.All(), key))
+	return c
+}
+
+// Partition splits the collection into elements which the function returns true and the rest
+func (c *Collection[T]) Partition(f func(i T) bool) (matched, rest *Collection[T]) {
+	matched, rest = &Collection[T]{data: make([]T, 0)}, &Collection[T]{data: make([]T, 0)}
+	for _, currentItem := range c.data {
+		if f(currentItem) {
+			matched.data = append(matched.data, currentItem)
+		} else {
+			rest.data = append(rest.data, currentItem)
+		}
+	}
+	return matched, rest
+}
+
+// By can be used as a key of SortBy, elements are sorted by the result of key in ascending order
+func By[T item, K cmp.Ordered](key func(i T) K) func(a, b T) int {
+	return func(a, b T) int {
+		return cmp.Compare(key(a), key(b))
+	}
+}
+
+// Desc reverses the order of a key of SortBy
+func Desc[T item](compare func(a, b T) int) func(a, b T) int {
+	return func(a, b T) int {
+		return compare(b, a)
+	}
+}
+
+// SortBy sorts by the first key, then the next key when they are equal.
+// The sort is stable, elements with all keys equal keep their order.
+func (c *Collection[T]) SortBy(keys ...func(a, b T) int) *Collection[T] {
+	slices.SortStableFunc(c.data, func(a, b T) int {
+		for _, compare := range keys {
+			if n := compare(a, b); n != 0 {
+				return n
+			}
+		}
+		return 0
+	})
+	return c
+}
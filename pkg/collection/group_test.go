@@ -0,0 +1,80 @@
+package collection
+
+import (
+	"reflect"
+	"testing"
+)
+
+type groupItem struct {
+	Topic string
+	Style string
+	Path  string
+}
+
+func groupItems() *Collection[groupItem] {
+	return New([]groupItem{
+		{"b", "File", "/b/2.log"},
+		{"a", "Date", "/a/1.log"},
+		{"b", "Date", "/b/1.log"},
+		{"a", "File", "/a/2.log"},
+		{"b", "File", "/b/3.log"},
+	})
+}
+
+func paths(items []groupItem) []string {
+	result := make([]string, 0, len(items))
+	for _, i := range items {
+		result = append(result, i.Path)
+	}
+	return result
+}
+
+func TestGroup(t *testing.T) {
+	topic := func(i groupItem) string { return i.Topic }
+	style := func(i groupItem) string { return i.Style }
+
+	groups := GroupBy(groupItems(), topic)
+	if len(groups) != 2 || !reflect.DeepEqual(paths(groups["b"].Value()), []string{"/b/2.log", "/b/1.log", "/b/3.log"}) {
+		t.Errorf("GroupBy got %v", groups)
+	}
+
+	if got := CountBy(groupItems(), style); !reflect.DeepEqual(got, map[string]int{"File": 3, "Date": 2}) {
+		t.Errorf("CountBy got %v", got)
+	}
+
+	if got := KeyBy(groupItems(), topic); got["a"].Path != "/a/2.log" || got["b"].Path != "/b/3.log" {
+		t.Errorf("KeyBy got %v", got)
+	}
+
+	if got := UniqueBy(groupItems(), style).Value(); !reflect.DeepEqual(paths(got), []string{"/b/2.log", "/a/1.log"}) {
+		t.Errorf("UniqueBy got %v", got)
+	}
+
+	matched, rest := groupItems().Partition(func(i groupItem) bool { return i.Style == "Date" })
+	if !reflect.DeepEqual(paths(matched.Value()), []string{"/a/1.log", "/b/1.log"}) || rest.Len() != 3 {
+		t.Errorf("Partition got %v %v", matched.Value(), rest.Value())
+	}
+}
+
+func TestSortBy(t *testing.T) {
+	topic := By(func(i groupItem) string { return i.Topic })
+	style := By(func(i groupItem) string { return i.Style })
+
+	tests := []struct {
+		name string
+		keys []func(a, b groupItem) int
+		want []string
+	}{
+		// 相同的元素保持原来的顺序
+		{"stable", []func(a, b groupItem) int{topic}, []string{"/a/1.log", "/a/2.log", "/b/2.log", "/b/1.log", "/b/3.log"}},
+		{"multi key", []func(a, b groupItem) int{topic, style}, []string{"/a/1.log", "/a/2.log", "/b/1.log", "/b/2.log", "/b/3.log"}},
+		{"desc", []func(a, b groupItem) int{Desc(style), topic}, []string{"/a/2.log", "/b/2.log", "/b/3.log", "/a/1.log", "/b/1.log"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := paths(groupItems().SortBy(tt.keys...).Value()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
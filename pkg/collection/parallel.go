@@ -0,0 +1,90 @@
+package collection
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// ParallelMapTo runs f on every element with at most workers goroutines, the result keeps the order of c.
+// workers <= 0 means runtime.GOMAXPROCS(0).
+// Errors of all elements are joined, elements are no longer started after ctx is done
+// and ctx.Err() is joined too. c is not changed.
+func ParallelMapTo[T, U item](ctx context.Context, c *Collection[T], workers int, f func(ctx context.Context, k int, i T) (U, error)) (*Collection[U], error) {
+	results := make([]U, len(c.data))
+	errs := make([]error, len(c.data))
+	err := parallel(ctx, len(c.data), workers, func(k int) {
+		results[k], errs[k] = f(ctx, k, c.data[k])
+	})
+	if err = errors.Join(append([]error{err}, errs...)...); err != nil {
+		return nil, err
+	}
+	return &Collection[U]{data: results}, nil
+}
+
+// ParallelMap is Map which runs f in parallel, see ParallelMapTo. c is not changed when there is an error.
+func (c *Collection[T]) ParallelMap(ctx context.Context, workers int, f func(ctx context.Context, k int, i T) (T, error)) (*Collection[T], error) {
+	mapped, err := ParallelMapTo(ctx, c, workers, f)
+	if err != nil {
+		return c, err
+	}
+	c.data = mapped.data
+	return c, nil
+}
+
+// ParallelFilter is Filter which runs f in parallel, see ParallelMapTo. c is not changed when there is an error.
+func (c *Collection[T]) ParallelFilter(ctx context.Context, workers int, f func(ctx context.Context, i T) (bool, error)) (*Collection[T], error) {
+	matched, err := ParallelMapTo(ctx, c, workers, func(ctx context.Context, k int, i T) (bool, error) {
+		return f(ctx, i)
+	})
+	if err != nil {
+		return c, err
+	}
+	match := make([]T, 0, len(c.data))
+	for k, currentItem := range c.data {
+		if matched.data[k] {
+			match = append(match, currentItem)
+		}
+	}
+	c.data = match
+	return c, nil
+}
+
+// parallel 用 workers 个协程执行 n 个任务，ctx 结束后不再开始新的任务，返回 ctx.Err()
+func parallel(ctx context.Context, n, workers int, run func(k int)) error {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, n)
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range jobs {
+				run(k)
+			}
+		}()
+	}
+
+	var err error
+dispatch:
+	for k := 0; k < n; k++ {
+		// 已经结束的 ctx 优先，避免 select 随机选中还能发送的任务
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		select {
+		case jobs <- k:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return err
+}
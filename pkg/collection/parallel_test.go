@@ -0,0 +1,87 @@
+package collection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParallelMap(t *testing.T) {
+	d := make([]int, 100)
+	for i := range d {
+		d[i] = i
+	}
+
+	var running, maxRunning int32
+	got, err := ParallelMapTo(context.Background(), New(d), 4, func(ctx context.Context, k int, i int) (string, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		// 后面的先完成，结果仍然保持原来的顺序
+		time.Sleep(time.Duration(100-i) * 10 * time.Microsecond)
+		return fmt.Sprint(k), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range got.Value() {
+		if v != fmt.Sprint(i) {
+			t.Fatalf("got %v at %d", v, i)
+		}
+	}
+	if maxRunning > 4 {
+		t.Errorf("%d workers running, want at most 4", maxRunning)
+	}
+}
+
+func TestParallelFilterErrors(t *testing.T) {
+	c := New([]int{1, 2, 3, 4, 5, 6})
+	got, err := c.ParallelFilter(context.Background(), 0, func(ctx context.Context, i int) (bool, error) {
+		return i%2 == 0, nil
+	})
+	if err != nil || !reflect.DeepEqual(got.Value(), []int{2, 4, 6}) {
+		t.Fatalf("got %v, %v", got.Value(), err)
+	}
+
+	errOdd := errors.New("odd")
+	c = New([]int{1, 2, 3, 4, 5})
+	_, err = c.ParallelMap(context.Background(), 2, func(ctx context.Context, k int, i int) (int, error) {
+		if i%2 == 1 {
+			return 0, fmt.Errorf("%d: %w", i, errOdd)
+		}
+		return i * 10, nil
+	})
+	if !errors.Is(err, errOdd) || err.Error() != "1: odd\n3: odd\n5: odd" {
+		t.Errorf("got error %q", err)
+	}
+	// 出错时不修改原来的数据
+	if !reflect.DeepEqual(c.Value(), []int{1, 2, 3, 4, 5}) {
+		t.Errorf("got %v after error", c.Value())
+	}
+}
+
+func TestParallelCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var started int32
+	_, err := ParallelMapTo(ctx, New(make([]int, 100)), 2, func(ctx context.Context, k int, i int) (int, error) {
+		if atomic.AddInt32(&started, 1) == 3 {
+			cancel()
+		}
+		return i, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+	if n := atomic.LoadInt32(&started); n > 5 {
+		t.Errorf("%d elements started after cancel", n)
+	}
+}
@@ -0,0 +1,153 @@
+// Package seq 基于 iter.Seq 的惰性流水线，每个元素依次流过所有的步骤，
+// 中间不会生成切片或者链表，适合处理阶段的热路径
+// 使用 slices.Values 开始，slices.Collect 结束
+package seq
+
+import "iter"
+
+// Map can be used to map every element, k is the index in the sequence
+func Map[T any](s iter.Seq[T], f func(k int, i T) T) iter.Seq[T] {
+	return MapTo(s, f)
+}
+
+// MapTo is Map which changes the type of elements
+func MapTo[T, U any](s iter.Seq[T], f func(k int, i T) U) iter.Seq[U] {
+	return func(yield func(U) bool) {
+		k := 0
+		for v := range s {
+			if !yield(f(k, v)) {
+				return
+			}
+			k++
+		}
+	}
+}
+
+// Filter can be used to keep elements only when the function returns true
+func Filter[T any](s iter.Seq[T], f func(i T) bool) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for v := range s {
+			if f(v) && !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// Take can be used to get the first n elements, the rest of the sequence is not read
+func Take[T any](s iter.Seq[T], n int) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		if n <= 0 {
+			return
+		}
+		taken := 0
+		for v := range s {
+			if !yield(v) {
+				return
+			}
+			taken++
+			if taken >= n {
+				return
+			}
+		}
+	}
+}
+
+// Skip can be used to drop the first n elements
+func Skip[T any](s iter.Seq[T], n int) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		skipped := 0
+		for v := range s {
+			if skipped < n {
+				skipped++
+				continue
+			}
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// Chunk splits the sequence into slices of size n, the last one may be shorter
+func Chunk[T any](s iter.Seq[T], n int) iter.Seq[[]T] {
+	return func(yield func([]T) bool) {
+		if n <= 0 {
+			return
+		}
+		chunk := make([]T, 0, n)
+		for v := range s {
+			chunk = append(chunk, v)
+			if len(chunk) < n {
+				continue
+			}
+			if !yield(chunk) {
+				return
+			}
+			// 每一块都是新的切片，调用方可以保留它
+			chunk = make([]T, 0, n)
+		}
+		if len(chunk) > 0 {
+			yield(chunk)
+		}
+	}
+}
+
+// Window yields every n consecutive elements, a sequence shorter than n yields nothing
+func Window[T any](s iter.Seq[T], n int) iter.Seq[[]T] {
+	return func(yield func([]T) bool) {
+		if n <= 0 {
+			return
+		}
+		window := make([]T, 0, n)
+		for v := range s {
+			if len(window) == n {
+				window = window[1:]
+			}
+			window = append(window, v)
+			if len(window) < n {
+				continue
+			}
+			// 复制一份，避免下一个窗口覆盖调用方拿到的内容
+			if !yield(append([]T(nil), window...)) {
+				return
+			}
+		}
+	}
+}
+
+// Distinct keeps the first element of every key
+func Distinct[T any, K comparable](s iter.Seq[T], key func(i T) K) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		seen := make(map[K]struct{})
+		for v := range s {
+			k := key(v)
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// GroupBy reads the whole sequence and groups elements by key, elements keep their order in every group
+func GroupBy[T any, K comparable](s iter.Seq[T], key func(i T) K) map[K][]T {
+	groups := make(map[K][]T)
+	for v := range s {
+		k := key(v)
+		groups[k] = append(groups[k], v)
+	}
+	return groups
+}
+
+// Reduce reads the whole sequence and folds it into one value
+func Reduce[T, A any](s iter.Seq[T], init A, f func(acc A, i T) A) A {
+	acc := init
+	for v := range s {
+		acc = f(acc, v)
+	}
+	return acc
+}
@@ -0,0 +1,68 @@
+package seq
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestPipeline(t *testing.T) {
+	numbers := []int{1, 2, 3, 4, 5, 6, 7}
+	double := func(k int, i int) int { return i * 2 }
+	odd := func(i int) bool { return i%2 == 1 }
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"map", slices.Collect(Map(slices.Values(numbers), double)), []int{2, 4, 6, 8, 10, 12, 14}},
+		{"map index", slices.Collect(Map(slices.Values([]int{5, 5}), func(k int, i int) int { return k })), []int{0, 1}},
+		{"filter", slices.Collect(Filter(slices.Values(numbers), odd)), []int{1, 3, 5, 7}},
+		{"take", slices.Collect(Take(slices.Values(numbers), 3)), []int{1, 2, 3}},
+		{"take more", slices.Collect(Take(slices.Values(numbers), 10)), numbers},
+		{"take zero", slices.Collect(Take(slices.Values(numbers), 0)), []int(nil)},
+		{"skip", slices.Collect(Skip(slices.Values(numbers), 5)), []int{6, 7}},
+		{"chunk", slices.Collect(Chunk(slices.Values(numbers), 3)), [][]int{{1, 2, 3}, {4, 5, 6}, {7}}},
+		{"window", slices.Collect(Window(slices.Values(numbers[:4]), 2)), [][]int{{1, 2}, {2, 3}, {3, 4}}},
+		{"window short", slices.Collect(Window(slices.Values(numbers[:1]), 2)), [][]int(nil)},
+		{"distinct", slices.Collect(Distinct(slices.Values([]string{"a", "B", "b", "A", "c"}), func(i string) string {
+			return string(i[0] | 0x20)
+		})), []string{"a", "B", "c"}},
+		{"group by", GroupBy(slices.Values(numbers), odd), map[bool][]int{true: {1, 3, 5, 7}, false: {2, 4, 6}}},
+		{"reduce", Reduce(slices.Values(numbers), 0, func(acc, i int) int { return acc + i }), 28},
+		{"map to", slices.Collect(MapTo(Filter(slices.Values(numbers), odd), func(k int, i int) string {
+			return string(rune('a' + i))
+		})), []string{"b", "d", "f", "h"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLazy(t *testing.T) {
+	// Take 之后的元素不会被读取和处理
+	mapped := 0
+	s := Map(slices.Values([]int{1, 2, 3, 4, 5}), func(k int, i int) int {
+		mapped++
+		return i
+	})
+	if got := slices.Collect(Take(s, 2)); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Fatalf("got %v", got)
+	}
+	if mapped != 2 {
+		t.Errorf("mapped %d elements, want 2", mapped)
+	}
+
+	// 提前结束时不会再 yield
+	for chunk := range Chunk(slices.Values([]int{1, 2, 3}), 2) {
+		if len(chunk) != 2 {
+			t.Errorf("got chunk %v", chunk)
+		}
+		break
+	}
+}
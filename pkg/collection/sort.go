@@ -1,66 +1,46 @@
 package collection
 
-import (
-	"container/list"
-)
-
-// mergeSort 好像链表排序中的归并效率比较高，为O(nlogn)，但是空间开销比较大
-func mergeSort[T item](lst *list.List, f func(i, j T) bool) *list.List {
-	if lst.Len() <= 1 {
-		return lst
+// mergeSort 归并排序，和 f 的结果一致：f(左, 右) 为 true 时左边的排在前面
+// 左右两半交替使用 d 和 buf，只需要一次额外的空间
+func mergeSort[T item](d []T, f func(i, j T) bool) []T {
+	if len(d) <= 1 {
+		return d
 	}
-	// 将链表分为两半
-	left, right := cut(lst)
-	// 递归地对左右两半进行排序
-	left = mergeSort(left, f)
-	right = mergeSort(right, f)
-
-	// 合并左右两个已排序的链表
-	return merge(left, right, f)
+	buf := make([]T, len(d))
+	copy(buf, d)
+	sortInto(buf, d, f)
+	return d
 }
 
-// cut 将链表对半分
-func cut(lst *list.List) (left, right *list.List) {
-	left = list.New()
-	right = lst
-	if lst.Len() <= 1 {
+// sortInto 把 src 排序后写入 dst，两者的内容相同
+func sortInto[T item](src, dst []T, f func(i, j T) bool) {
+	if len(src) <= 1 {
 		return
 	}
-	// 快慢指针，快的走两个如果快的走完了就停下，慢的就是一半了，剩下都就是另一半
-	for slow, fast := lst.Front(), lst.Front(); fast != nil; fast, slow = slow.Next(), fast.Next() {
-		fast = fast.Next()
-		if fast == nil {
-			break
-		}
-		left.PushBack(slow.Value)
-		right.Remove(slow)
-	}
-	return
-}
-
-// 合并两个已排序链表
-func merge[T item](left, right *list.List, f func(i, j T) bool) *list.List {
+	// 将切片分为两半，递归地把两半排序到 src 中
+	mid := len(src) / 2
+	sortInto(dst[:mid], src[:mid], f)
+	sortInto(dst[mid:], src[mid:], f)
 
-	result := list.New()
+	// 合并左右两个已排序的部分
+	merge(src[:mid], src[mid:], dst, f)
+}
 
-	for left.Len() > 0 && right.Len() > 0 {
-		if f(left.Front().Value.(T), right.Front().Value.(T)) {
-			result.PushBack(left.Front().Value)
-			left.Remove(left.Front())
+// 合并两个已排序的切片
+func merge[T item](left, right, result []T, f func(i, j T) bool) {
+	i, j, k := 0, 0, 0
+	for i < len(left) && j < len(right) {
+		if f(left[i], right[j]) {
+			result[k] = left[i]
+			i++
 		} else {
-			result.PushBack(right.Front().Value)
-			right.Remove(right.Front())
+			result[k] = right[j]
+			j++
 		}
+		k++
 	}
 
-	// 将剩余的元素添加到结果链表中
-	if left.Len() > 0 {
-		result.PushBackList(left)
-	}
-
-	if right.Len() > 0 {
-		result.PushBackList(right)
-	}
-
-	return result
+	// 将剩余的元素添加到结果中
+	k += copy(result[k:], left[i:])
+	copy(result[k:], right[j:])
 }
@@ -0,0 +1,166 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeLayout 轮转后文件名中的时间，比如 bifrost-20230601T100000.000.log
+const backupTimeLayout = "20060102T150405.000"
+
+// openFile 打开日志文件，测试中替换它来模拟打开失败
+var openFile = os.OpenFile
+
+// RotateWriter 写入文件，按照大小和时间轮转
+// 轮转后的文件名带上轮转的时间，超过 MaxAge 或者多于 MaxBackups 个时删除，零值表示不限制
+type RotateWriter struct {
+	Path        string
+	MaxSize     int64         // 再写入就超过这个大小时轮转
+	RotateEvery time.Duration // 文件打开超过这么久时轮转
+	MaxAge      time.Duration // 删除早于这个时间轮转的文件
+	MaxBackups  int           // 最多保留几个轮转后的文件
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// NewRotateWriter 以追加的方式打开 path，并删除过期的轮转文件
+func NewRotateWriter(path string, maxSize int64, rotateEvery, maxAge time.Duration, maxBackups int) (*RotateWriter, error) {
+	w := &RotateWriter{Path: path, MaxSize: maxSize, RotateEvery: rotateEvery, MaxAge: maxAge, MaxBackups: maxBackups}
+	f, size, err := w.open()
+	if err != nil {
+		return nil, err
+	}
+	w.file, w.size, w.openedAt = f, size, time.Now()
+	w.cleanup()
+	return w, nil
+}
+
+// open 打开 Path，返回文件和它当前的大小
+func (w *RotateWriter) open() (*os.File, int64, error) {
+	f, err := openFile(w.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, stat.Size(), nil
+}
+
+// Write 文件写满或者打开太久时先轮转再写入，一次写入的内容不会被拆到两个文件中
+// 轮转失败时继续写入当前的文件，下一次写入时再尝试轮转
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var rotateErr error
+	if w.size > 0 && w.shouldRotate(len(p)) {
+		rotateErr = w.rotate()
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	if err != nil {
+		return n, err
+	}
+	return n, rotateErr
+}
+
+func (w *RotateWriter) shouldRotate(n int) bool {
+	if w.MaxSize > 0 && w.size+int64(n) > w.MaxSize {
+		return true
+	}
+	return w.RotateEvery > 0 && time.Since(w.openedAt) >= w.RotateEvery
+}
+
+// Rotate 重命名当前的文件并打开一个新的
+func (w *RotateWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rotate()
+}
+
+// rotate 先打开新的文件，成功后才关闭旧的，失败时把旧文件改回原来的名字继续写入
+func (w *RotateWriter) rotate() error {
+	ext := filepath.Ext(w.Path)
+	backup := strings.TrimSuffix(w.Path, ext) + "-" + time.Now().Format(backupTimeLayout) + ext
+	renamed := true
+	if err := os.Rename(w.Path, backup); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		renamed = false
+	}
+	f, size, err := w.open()
+	if err != nil {
+		if renamed {
+			os.Rename(backup, w.Path)
+		}
+		return err
+	}
+	old := w.file
+	w.file, w.size, w.openedAt = f, size, time.Now()
+	// 删除旧文件不影响写入，放到后台
+	go w.cleanup()
+	// 已经切换到新文件了，旧文件关闭失败不影响写入
+	return old.Close()
+}
+
+// cleanup 删除超过 MaxAge 或者多于 MaxBackups 个的轮转文件
+func (w *RotateWriter) cleanup() {
+	backups, err := Backups(w.Path)
+	if err != nil {
+		return
+	}
+	for i, backup := range backups {
+		expired := w.MaxAge > 0 && time.Since(backup.RotatedAt) > w.MaxAge
+		if expired || (w.MaxBackups > 0 && i >= w.MaxBackups) {
+			os.Remove(backup.Path)
+		}
+	}
+}
+
+// Close 关闭当前的文件
+func (w *RotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
+
+// Backup 一个被 RotateWriter 轮转出去的文件
+type Backup struct {
+	Path      string
+	RotatedAt time.Time
+}
+
+// Backups 列出 path 轮转出去的文件，最新的在前面
+func Backups(path string) ([]Backup, error) {
+	ext := filepath.Ext(path)
+	prefix := strings.TrimSuffix(path, ext) + "-"
+	matches, err := filepath.Glob(prefix + "*" + ext)
+	if err != nil {
+		return nil, err
+	}
+	backups := make([]Backup, 0, len(matches))
+	for _, match := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(match, prefix), ext)
+		rotatedAt, err := time.ParseInLocation(backupTimeLayout, stamp, time.Local)
+		if err != nil {
+			// 名字相似的其他文件
+			continue
+		}
+		backups = append(backups, Backup{Path: match, RotatedAt: rotatedAt})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].RotatedAt.After(backups[j].RotatedAt)
+	})
+	return backups, nil
+}
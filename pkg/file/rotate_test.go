@@ -0,0 +1,120 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotateWriter(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bifrost.log")
+
+	w, err := NewRotateWriter(path, 10, 0, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "gggg\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		// 轮转后的文件名精确到毫秒
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	current, _ := os.ReadFile(path)
+	if string(current) != "gggg\n" {
+		t.Errorf("current file = %q", current)
+	}
+
+	// 清理在后台进行
+	var backups []Backup
+	for i := 0; i < 100; i++ {
+		backups, _ = Backups(path)
+		if len(backups) == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("got %d backups, want 2", len(backups))
+	}
+	newest, _ := os.ReadFile(backups[0].Path)
+	if string(newest) != "eeee\nffff\n" {
+		t.Errorf("newest backup = %q", newest)
+	}
+	if !strings.HasPrefix(filepath.Base(backups[0].Path), "bifrost-") {
+		t.Errorf("backup name %s", backups[0].Path)
+	}
+}
+
+func TestRotateWriterMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bifrost.log")
+	old := filepath.Join(dir, "bifrost-"+time.Now().Add(-48*time.Hour).Format(backupTimeLayout)+".log")
+	recent := filepath.Join(dir, "bifrost-"+time.Now().Add(-time.Hour).Format(backupTimeLayout)+".log")
+	other := filepath.Join(dir, "bifrost-other.log")
+	for _, name := range []string{old, recent, other} {
+		os.WriteFile(name, []byte("x\n"), 0644)
+	}
+
+	w, err := NewRotateWriter(path, 0, 0, 24*time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	for name, want := range map[string]bool{old: false, recent: true, other: true} {
+		if _, err := os.Stat(name); (err == nil) != want {
+			t.Errorf("%s exists = %v, want %v", filepath.Base(name), err == nil, want)
+		}
+	}
+}
+
+func TestRotateWriterOpenFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bifrost.log")
+
+	w, err := NewRotateWriter(path, 10, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if _, err := w.Write([]byte("aaaa\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 打不开新文件时继续写入原来的文件
+	openFile = func(string, int, os.FileMode) (*os.File, error) { return nil, os.ErrPermission }
+	n, err := w.Write([]byte("bbbbbbbb\n"))
+	openFile = os.OpenFile
+	if err == nil || n != 9 {
+		t.Fatalf("Write() = %d, %v, want 9 and the open error", n, err)
+	}
+	if current, _ := os.ReadFile(path); string(current) != "aaaa\nbbbbbbbb\n" {
+		t.Errorf("current file = %q", current)
+	}
+	if backups, _ := Backups(path); len(backups) != 0 {
+		t.Errorf("got %d backups, want 0", len(backups))
+	}
+
+	// 恢复后下一次写入正常轮转
+	time.Sleep(2 * time.Millisecond)
+	if _, err := w.Write([]byte("cccc\n")); err != nil {
+		t.Fatal(err)
+	}
+	if current, _ := os.ReadFile(path); string(current) != "cccc\n" {
+		t.Errorf("current file after rotation = %q", current)
+	}
+	backups, _ := Backups(path)
+	if len(backups) != 1 {
+		t.Fatalf("got %d backups, want 1", len(backups))
+	}
+	if backup, _ := os.ReadFile(backups[0].Path); string(backup) != "aaaa\nbbbbbbbb\n" {
+		t.Errorf("backup = %q", backup)
+	}
+}
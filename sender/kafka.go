@@ -2,15 +2,27 @@ package sender
 
 import (
 	"strings"
+	"time"
 
 	"github.com/segmentio/kafka-go"
 	"github.com/y7ut/logagent/conf"
 )
 
-func InitWriter() *kafka.Writer {
+// kafka 默认的单个请求大小上限
+const defaultBatchBytes = 1048576
+
+// InitWriter 创建 Kafka 写入器
+// 批次已经由调用方按条数、字节数和等待时间攒好，所以这里的 BatchTimeout 只需要很短
+func InitWriter(batchSize int, batchBytes int) *kafka.Writer {
+	if batchBytes < defaultBatchBytes {
+		batchBytes = defaultBatchBytes
+	}
 	w := &kafka.Writer{
-		Addr:     kafka.TCP(strings.Split(conf.APPConfig.Kafka.Address, ",")...),
-		Balancer: &kafka.LeastBytes{},
+		Addr:         kafka.TCP(strings.Split(conf.APPConfig.Kafka.Address, ",")...),
+		Balancer:     &kafka.LeastBytes{},
+		BatchSize:    batchSize,
+		BatchBytes:   int64(batchBytes),
+		BatchTimeout: 10 * time.Millisecond,
 	}
 	return w
 }